@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/max-durnea/blog-aggregator/internal/database"
+)
+
+type command struct {
+	name string
+	args []string
+	//values of the flags of the command by name, filled in by commands.run
+	flags map[string]any
+	//the flags given on the command line, the others hold their defaults
+	given map[string]bool
+}
+
+//the value of a flag, the handler must have declared it in its commandSpec
+func (cmd command) stringFlag(name string) string {
+	return cmd.flags[name].(string)
+}
+
+func (cmd command) intFlag(name string) int {
+	return cmd.flags[name].(int)
+}
+
+func (cmd command) boolFlag(name string) bool {
+	return cmd.flags[name].(bool)
+}
+
+func (cmd command) durationFlag(name string) time.Duration {
+	return cmd.flags[name].(time.Duration)
+}
+
+func (cmd command) stringsFlag(name string) []string {
+	return cmd.flags[name].([]string)
+}
+
+//whether the flag was given rather than left at its default
+func (cmd command) flagGiven(name string) bool {
+	return cmd.given[name]
+}
+
+//a positional argument of a command, for help and completion
+type argSpec struct {
+	name        string
+	description string
+	optional    bool
+	//the argument can be given any number of times
+	repeated bool
+	//values offered by shell completion, if any
+	complete completer
+}
+
+//a flag of a command like --limit 20, the default value decides the type:
+//string, int, bool, time.Duration or []string for a flag that can be given more than once
+type flagSpec struct {
+	name     string
+	usage    string
+	value    any
+	complete completer
+}
+
+//flag.Value for every flag type, so bad values get the same clear errors
+type flagValue struct {
+	value any
+}
+
+func (v *flagValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return fmt.Sprint(v.value)
+}
+
+func (v *flagValue) Get() any {
+	return v.value
+}
+
+func (v *flagValue) Set(text string) error {
+	switch v.value.(type) {
+	case string:
+		v.value = text
+	case []string:
+		v.value = append(v.value.([]string), text)
+	case int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return errors.New("want a whole number")
+		}
+		v.value = n
+	case bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return errors.New("want true or false")
+		}
+		v.value = b
+	case time.Duration:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return errors.New("want a duration like 30s, 5m or 24h")
+		}
+		v.value = d
+	}
+	return nil
+}
+
+//lets --unread stand on its own without a value
+func (v *flagValue) IsBoolFlag() bool {
+	_, ok := v.value.(bool)
+	return ok
+}
+
+//what help shows after the flag name
+func (f flagSpec) typeName() string {
+	switch f.value.(type) {
+	case int:
+		return "int"
+	case time.Duration:
+		return "duration"
+	case string, []string:
+		return "string"
+	}
+	return ""
+}
+
+//everything gator knows about a command
+type commandSpec struct {
+	name    string
+	summary string
+	args    []argSpec
+	flags   []flagSpec
+	//runs through middlewareLoggedIn and receives the current user
+	requiresLogin bool
+	//runs until it is stopped, the command timeout does not apply
+	longRunning bool
+	//left out of help and suggestions
+	hidden bool
+	//handles Ctrl-C itself instead of being cancelled by it, see main
+	interactive bool
+	handler func(context.Context, *state, command) error
+	//set instead of handler for commands that need a logged in user
+	userHandler func(context.Context, *state, command, database.User) error
+}
+
+//the argument part of the usage line, e.g. "<name> <url> [type] [key=value...]"
+func (spec *commandSpec) usage() string {
+	parts := []string{spec.name}
+	for _, arg := range spec.args {
+		part := arg.name
+		if arg.repeated {
+			part += "..."
+		}
+		if arg.optional {
+			part = "[" + part + "]"
+		} else {
+			part = "<" + part + ">"
+		}
+		parts = append(parts, part)
+	}
+	if len(spec.flags) > 0 {
+		parts = append(parts, "[flags]")
+	}
+	return strings.Join(parts, " ")
+}
+
+//split cmd.args into flags and positional arguments, flags may come before, between or
+//after the arguments and "--" ends them. Returns flag.ErrHelp for -h and --help
+func (spec *commandSpec) parse(cmd command) (command, error) {
+	fs := flag.NewFlagSet(spec.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	values := map[string]*flagValue{}
+	for _, f := range spec.flags {
+		values[f.name] = &flagValue{value: f.value}
+		fs.Var(values[f.name], f.name, f.usage)
+	}
+	var args []string
+	rest := cmd.args
+	for len(rest) > 0 {
+		if err := fs.Parse(rest); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return cmd, err
+			}
+			return cmd, invalidArgument("%v, see gator help %v", err, spec.name)
+		}
+		consumed := len(rest) - fs.NArg()
+		if consumed > 0 && rest[consumed-1] == "--" {
+			args = append(args, fs.Args()...)
+			break
+		}
+		rest = fs.Args()
+		if len(rest) > 0 {
+			args = append(args, rest[0])
+			rest = rest[1:]
+		}
+	}
+
+	required, allowed := 0, len(spec.args)
+	for _, arg := range spec.args {
+		if !arg.optional {
+			required++
+		}
+		if arg.repeated {
+			allowed = -1
+		}
+	}
+	if len(args) < required {
+		return cmd, invalidArgument("missing %v, usage: gator %v", spec.args[len(args)].name, spec.usage())
+	}
+	if allowed >= 0 && len(args) > allowed {
+		return cmd, invalidArgument("too many arguments, usage: gator %v", spec.usage())
+	}
+
+	cmd.args = args
+	cmd.flags = map[string]any{}
+	for name, value := range values {
+		cmd.flags[name] = value.value
+	}
+	cmd.given = map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		cmd.given[f.Name] = true
+	})
+	return cmd, nil
+}
+
+//store the commands by name
+type commands struct {
+	specs map[string]*commandSpec
+	//how long commands that are not long running may run, 0 for no limit
+	timeout time.Duration
+	//the logger before any command was run, so commands run from the shell
+	//are logged under their own name only
+	logger *slog.Logger
+}
+
+func newCommands() *commands {
+	return &commands{specs: map[string]*commandSpec{}}
+}
+
+//cleanup after a cancelled command or fetch, like recording the fetch, gets this long
+const cleanupTimeout = 5 * time.Second
+
+//whether the command handles Ctrl-C itself
+func (c *commands) interactive(name string) bool {
+	spec, ok := c.specs[name]
+	return ok && spec.interactive
+}
+
+//register a new command
+func (c *commands) register(spec commandSpec) {
+	if spec.userHandler != nil {
+		spec.requiresLogin = true
+		spec.handler = middlewareLoggedIn(spec.userHandler)
+	}
+	c.specs[spec.name] = &spec
+}
+
+//run a command and return its exit code, see exitCodes
+func (c *commands) run(ctx context.Context, s *state, cmd command) int {
+	//everything logged while the command runs says which command it was
+	previous := slog.Default()
+	if c.logger == nil {
+		c.logger = previous
+	}
+	slog.SetDefault(c.logger.With("command", cmd.name))
+	defer slog.SetDefault(previous)
+
+	spec, ok := c.specs[cmd.name]
+	if !ok {
+		err := c.unknownCommand(cmd.name)
+		return commandFailed(kindOf(err), err)
+	}
+	cmd, err := spec.parse(cmd)
+	if errors.Is(err, flag.ErrHelp) {
+		c.handlerHelp(ctx, s, command{name: "help", args: []string{spec.name}})
+		return 0
+	}
+	if err != nil {
+		return commandFailed(kindOf(err), err)
+	}
+	if spec.longRunning {
+		//long running commands shut down on their own when ctx is cancelled
+		err = spec.handler(ctx, s, cmd)
+	} else {
+		if c.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+		}
+		err = runWithContext(ctx, s, cmd, spec.handler)
+	}
+	if err != nil {
+		kind := kindOf(err)
+		//the driver does not always hand back the context error itself
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			kind = kindOf(ctxErr)
+		}
+		return commandFailed(kind, err)
+	}
+	return 0
+}
+
+//report a failed command and return its exit code. The message goes to stderr even when
+//logs go to a file, so a failure is never silent
+func commandFailed(kind errorKind, err error) int {
+	slog.Error("Command failed", "kind", kindNames[kind], "err", err)
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return exitCodes[kind]
+}
+
+//run a handler, giving up on it cleanupTimeout after ctx is done. The postgres driver
+//does not watch the context while it connects, so a hung server could block forever.
+//The handler keeps running after we give up, in the shell it is left in the session
+//so no other command touches the state before it returns
+func runWithContext(ctx context.Context, s *state, cmd command, handler func(context.Context, *state, command) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- handler(ctx, s, cmd)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(cleanupTimeout):
+		if s.session != nil {
+			s.session.abandoned = done
+		}
+		return ctx.Err()
+	}
+}
+
+//the error for a command we do not know, with the closest names if there are any
+func (c *commands) unknownCommand(name string) error {
+	if suggestions := c.suggest(name); len(suggestions) > 0 {
+		return invalidArgument("unknown command %q, did you mean %v?", name, strings.Join(suggestions, " or "))
+	}
+	return invalidArgument("unknown command %q, run gator help for the list of commands", name)
+}
+
+//visible commands that start with name or are at most two edits away from it
+func (c *commands) suggest(name string) []string {
+	var suggestions []string
+	for _, spec := range c.visible() {
+		if strings.HasPrefix(spec.name, name) || editDistance(name, spec.name) <= 2 {
+			suggestions = append(suggestions, spec.name)
+		}
+	}
+	return suggestions
+}
+
+//the commands shown in help, sorted by name
+func (c *commands) visible() []*commandSpec {
+	var specs []*commandSpec
+	for _, spec := range c.specs {
+		if !spec.hidden {
+			specs = append(specs, spec)
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].name < specs[j].name
+	})
+	return specs
+}
+
+//Levenshtein distance between two command names
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+//list the commands, or show the details of one: help [command]
+func (c *commands) handlerHelp(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) > 1 {
+		return invalidArgument("provide at most one command")
+	}
+	if len(cmd.args) == 0 {
+		fmt.Println("Usage: gator [--log-level level] [--log-format text|json] [--log-file path] [--timeout duration] [--output text|json|jsonl|csv|table] <command> [arguments]")
+		fmt.Println()
+		fmt.Println("Commands:")
+		for _, spec := range c.visible() {
+			fmt.Printf("  %-10v %v\n", spec.name, spec.summary)
+		}
+		fmt.Println()
+		fmt.Println("Run gator help <command> for the details of a command.")
+		return nil
+	}
+	spec, ok := c.specs[cmd.args[0]]
+	if !ok {
+		return c.unknownCommand(cmd.args[0])
+	}
+	fmt.Printf("Usage: gator %v\n\n%v\n", spec.usage(), spec.summary)
+	if len(spec.args) > 0 {
+		fmt.Println()
+		fmt.Println("Arguments:")
+		for _, arg := range spec.args {
+			fmt.Printf("  %-12v %v\n", arg.name, arg.description)
+		}
+	}
+	if len(spec.flags) > 0 {
+		fmt.Println()
+		fmt.Println("Flags:")
+		for _, f := range spec.flags {
+			usage := f.usage
+			if def := fmt.Sprint(f.value); def != "" && def != "0" && def != "0s" && def != "false" && def != "[]" {
+				usage += fmt.Sprintf(" (default %v)", def)
+			}
+			fmt.Printf("  %-28v %v\n", strings.TrimSpace("--"+f.name+" "+f.typeName()), usage)
+		}
+	}
+	if spec.requiresLogin {
+		fmt.Println()
+		fmt.Println("Requires a logged in user, see login and register.")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "feeds", 5},
+		{"feeds", "", 5},
+		{"feeds", "feeds", 0},
+		{"fedes", "feeds", 2},
+		{"feed", "feeds", 1},
+		{"brwse", "browse", 1},
+		{"follwo", "follow", 2},
+		{"agg", "reset", 5},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCommandSpecParse(t *testing.T) {
+	spec := &commandSpec{
+		name: "test",
+		args: []argSpec{{name: "url"}, {name: "limit", optional: true}},
+		flags: []flagSpec{
+			{name: "limit", value: 2},
+			{name: "feed", value: []string(nil)},
+			{name: "unread", value: false},
+			{name: "since", value: time.Duration(0)},
+			{name: "match", value: ""},
+		},
+	}
+	defaults := map[string]any{"limit": 2, "feed": []string(nil), "unread": false, "since": time.Duration(0), "match": ""}
+	with := func(values map[string]any) map[string]any {
+		flags := maps.Clone(defaults)
+		maps.Copy(flags, values)
+		return flags
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		flags   map[string]any
+		given   []string
+		wantErr error
+	}{
+		{"arguments only", []string{"u", "5"}, []string{"u", "5"}, defaults, nil, nil},
+		{"flags before, between and after", []string{"--unread", "u", "--limit", "7", "5", "--match", "go"},
+			[]string{"u", "5"}, with(map[string]any{"unread": true, "limit": 7, "match": "go"}), []string{"limit", "match", "unread"}, nil},
+		{"= values and one dash", []string{"-limit=3", "--since=24h", "u"},
+			[]string{"u"}, with(map[string]any{"limit": 3, "since": 24 * time.Hour}), []string{"limit", "since"}, nil},
+		{"repeated flag", []string{"u", "--feed", "a", "--feed=b"},
+			[]string{"u"}, with(map[string]any{"feed": []string{"a", "b"}}), []string{"feed"}, nil},
+		{"bool flag set to its default still counts as given", []string{"u", "--unread=false"},
+			[]string{"u"}, defaults, []string{"unread"}, nil},
+		{"-- ends the flags", []string{"--limit", "4", "--", "--unread", "-5"},
+			[]string{"--unread", "-5"}, with(map[string]any{"limit": 4}), []string{"limit"}, nil},
+		{"help", []string{"u", "--help"}, nil, nil, nil, flag.ErrHelp},
+		{"bad int", []string{"u", "--limit", "many"}, nil, nil, nil, errInvalid},
+		{"bad duration", []string{"u", "--since", "1 day"}, nil, nil, nil, errInvalid},
+		{"unknown flag", []string{"u", "--nope"}, nil, nil, nil, errInvalid},
+		{"missing argument", []string{"--unread"}, nil, nil, nil, errInvalid},
+		{"too many arguments", []string{"u", "5", "6"}, nil, nil, nil, errInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := spec.parse(command{name: "test", args: tt.args})
+			switch {
+			case tt.wantErr == errInvalid:
+				if kindOf(err) != kindInvalidArgument {
+					t.Fatalf("parse(%q) error = %v, want an invalid argument", tt.args, err)
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parse(%q) error = %v, want %v", tt.args, err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("parse(%q): %v", tt.args, err)
+			}
+			given := slices.Sorted(maps.Keys(cmd.given))
+			if !slices.Equal(cmd.args, tt.want) || !reflect.DeepEqual(cmd.flags, tt.flags) || !slices.Equal(given, tt.given) {
+				t.Errorf("parse(%q) = args %q, flags %v, given %q; want %q, %v, %q", tt.args, cmd.args, cmd.flags, given, tt.want, tt.flags, tt.given)
+			}
+		})
+	}
+}
+
+//stands for any invalid argument error in TestCommandSpecParse
+var errInvalid = errors.New("invalid argument")
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+//completions query the database, but a shell waiting on them must not hang
+const completionTimeout = 2 * time.Second
+
+//dynamic values for an argument or flag, filtered by prefix afterwards
+type completer func(ctx context.Context, s *state) ([]string, error)
+
+//a completer for a fixed set of values
+func choices(values ...string) completer {
+	return func(ctx context.Context, s *state) ([]string, error) {
+		//a copy, callers like --flag=value completion rewrite the values
+		return slices.Clone(values), nil
+	}
+}
+
+//the global flags parsed in main, they all take a value
+var globalFlagNames = []string{"--log-level", "--log-format", "--log-file", "--timeout", "--output"}
+
+func completeUserNames(ctx context.Context, s *state) ([]string, error) {
+	users, err := s.db.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	return names, nil
+}
+
+func completeFeedNames(ctx context.Context, s *state) ([]string, error) {
+	feeds, err := s.db.GetFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(feeds))
+	for _, feed := range feeds {
+		names = append(names, feed.Name)
+	}
+	return names, nil
+}
+
+func completeFeedURLs(ctx context.Context, s *state) ([]string, error) {
+	feeds, err := s.db.GetFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(feeds))
+	for _, feed := range feeds {
+		urls = append(urls, feed.Url)
+	}
+	return urls, nil
+}
+
+//the URLs of the feeds the current user follows, nothing when nobody is logged in
+func completeFollowedURLs(ctx context.Context, s *state) ([]string, error) {
+	if s.cfg.CurrentUserName == "" {
+		return nil, nil
+	}
+	user, err := s.db.GetUser(ctx, s.cfg.CurrentUserName)
+	if err != nil {
+		return nil, err
+	}
+	follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(follows))
+	for _, follow := range follows {
+		urls = append(urls, follow.FeedUrl)
+	}
+	return urls, nil
+}
+
+//the names of the visible commands, for help
+func (c *commands) completeCommandNames(ctx context.Context, s *state) ([]string, error) {
+	var names []string
+	for _, spec := range c.visible() {
+		names = append(names, spec.name)
+	}
+	return names, nil
+}
+
+//called by the completion scripts: __complete -- <words after gator>, the last word is the one
+//being completed. Prints one candidate per line and never fails, errors only go to the log
+func (c *commands) handlerComplete(ctx context.Context, s *state, cmd command) error {
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+	words := cmd.args
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	for _, candidate := range c.complete(ctx, s, words) {
+		fmt.Println(candidate)
+	}
+	return nil
+}
+
+func (c *commands) complete(ctx context.Context, s *state, words []string) []string {
+	current := words[len(words)-1]
+	//skip the global flags and their values
+	i := 0
+	for i < len(words)-1 && strings.HasPrefix(words[i], "-") {
+		if strings.Contains(words[i], "=") {
+			i++
+		} else {
+			i += 2
+		}
+	}
+	if i >= len(words)-1 {
+		if i > len(words)-1 {
+			//completing the value of a global flag
+			return nil
+		}
+		if strings.HasPrefix(current, "-") {
+			return filterPrefix(globalFlagNames, current)
+		}
+		names, _ := c.completeCommandNames(ctx, s)
+		return filterPrefix(names, current)
+	}
+	spec, ok := c.specs[words[i]]
+	if !ok {
+		return nil
+	}
+
+	//--flag=value
+	if name, value, ok := strings.Cut(current, "="); ok && strings.HasPrefix(name, "-") {
+		if f := spec.flag(name); f != nil && f.complete != nil {
+			values := runCompleter(ctx, s, f.complete)
+			for j := range values {
+				values[j] = name + "=" + values[j]
+			}
+			return filterPrefix(values, name+"="+value)
+		}
+		return nil
+	}
+	//the value of the flag before it
+	rest := words[i+1 : len(words)-1]
+	if len(rest) > 0 {
+		last := rest[len(rest)-1]
+		if f := spec.flag(last); f != nil && f.typeName() != "" && strings.HasPrefix(last, "-") && !strings.Contains(last, "=") {
+			if f.complete == nil {
+				return nil
+			}
+			return filterPrefix(runCompleter(ctx, s, f.complete), current)
+		}
+	}
+	if strings.HasPrefix(current, "-") {
+		names := []string{"--help"}
+		for _, f := range spec.flags {
+			names = append(names, "--"+f.name)
+		}
+		return filterPrefix(names, current)
+	}
+
+	//count the arguments before the current one to find its argSpec
+	position := 0
+	for j := 0; j < len(rest); j++ {
+		word := rest[j]
+		switch {
+		case word == "--":
+			position += len(rest) - j - 1
+			j = len(rest)
+		case strings.HasPrefix(word, "-") && len(word) > 1:
+			if f := spec.flag(word); f != nil && f.typeName() != "" && !strings.Contains(word, "=") {
+				j++
+			}
+		default:
+			position++
+		}
+	}
+	if len(spec.args) == 0 {
+		return nil
+	}
+	if position >= len(spec.args) {
+		if !spec.args[len(spec.args)-1].repeated {
+			return nil
+		}
+		position = len(spec.args) - 1
+	}
+	if spec.args[position].complete == nil {
+		return nil
+	}
+	return filterPrefix(runCompleter(ctx, s, spec.args[position].complete), current)
+}
+
+//the flag spec for a word like --feed, -feed or --feed=x
+func (spec *commandSpec) flag(word string) *flagSpec {
+	name, _, _ := strings.Cut(strings.TrimLeft(word, "-"), "=")
+	for i := range spec.flags {
+		if spec.flags[i].name == name {
+			return &spec.flags[i]
+		}
+	}
+	return nil
+}
+
+func runCompleter(ctx context.Context, s *state, complete completer) []string {
+	values, err := complete(ctx, s)
+	if err != nil {
+		slog.Debug("Completion failed", "err", err)
+	}
+	return values
+}
+
+func filterPrefix(values []string, prefix string) []string {
+	var matches []string
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			matches = append(matches, value)
+		}
+	}
+	return matches
+}
+
+//print the completion script for a shell: completion bash|zsh|fish
+func handlerCompletion(ctx context.Context, s *state, cmd command) error {
+	script, ok := completionScripts[cmd.args[0]]
+	if !ok {
+		return invalidArgument("unknown shell %q, use bash, zsh or fish", cmd.args[0])
+	}
+	fmt.Print(script)
+	return nil
+}
+
+//the scripts hand everything typed after gator to __complete, which does the work
+var completionScripts = map[string]string{
+	"bash": `# gator completion for bash, add to ~/.bashrc:
+#   source <(gator completion bash)
+_gator() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        #keep URLs and --flag=value in one word
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        cur="${COMP_WORDS[COMP_CWORD]}"
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+    fi
+    #one candidate per line, read as is: no word splitting or globbing, and quoted so
+    #names with blanks or * stay one word. A read loop because macOS bash has no mapfile
+    COMPREPLY=()
+    local candidate
+    while IFS= read -r candidate; do
+        COMPREPLY+=("$(printf '%q' "$candidate")")
+    done < <(gator __complete -- "${words[@]:1:cword}" 2>/dev/null)
+    if declare -F __ltrim_colon_completions >/dev/null; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+complete -o default -F _gator gator
+`,
+	"zsh": `#compdef gator
+# gator completion for zsh, add to ~/.zshrc:
+#   source <(gator completion zsh)
+_gator() {
+    local -a completions
+    completions=(${(f)"$(gator __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    compadd -- "${completions[@]}"
+}
+if [ "$funcstack[1]" = "_gator" ]; then
+    _gator "$@"
+else
+    compdef _gator gator
+fi
+`,
+	"fish": `# gator completion for fish, add to ~/.config/fish/config.fish:
+#   gator completion fish | source
+function __gator_complete
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    set -l current (commandline -ct)
+    gator __complete -- $tokens "$current" 2>/dev/null
+end
+complete -c gator -f -a '(__gator_complete)'
+`,
+}
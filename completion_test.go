@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComplete(t *testing.T) {
+	c := newCommands()
+	c.register(commandSpec{
+		name: "browse",
+		args: []argSpec{{name: "limit", optional: true}},
+		flags: []flagSpec{
+			{name: "limit", value: 2},
+			{name: "feed", value: []string(nil), complete: choices("go-blog", "golang-weekly", "rust", "Rust Weekly", "C* digest")},
+			{name: "unread", value: false},
+			{name: "since", value: time.Duration(0)},
+		},
+	})
+	c.register(commandSpec{
+		name:  "follow",
+		args:  []argSpec{{name: "url", complete: choices("https://go.dev/blog/feed.atom", "https://blog.rust-lang.org/feed.xml")}},
+		flags: []flagSpec{{name: "sort", value: "created", complete: choices("name", "url", "created")}},
+	})
+	c.register(commandSpec{name: "feeds"})
+	c.register(commandSpec{
+		name: "unfollow",
+		args: []argSpec{{name: "url", repeated: true, complete: choices("https://go.dev/blog/feed.atom")}},
+	})
+	c.register(commandSpec{name: "__complete", hidden: true})
+
+	tests := []struct {
+		name  string
+		words []string
+		want  []string
+	}{
+		{"every visible command", []string{""}, []string{"browse", "feeds", "follow", "unfollow"}},
+		{"command prefix", []string{"f"}, []string{"feeds", "follow"}},
+		{"global flags", []string{"--l"}, []string{"--log-level", "--log-format", "--log-file"}},
+		{"command after a global flag", []string{"--output", "json", "fe"}, []string{"feeds"}},
+		{"value of a global flag", []string{"--output", ""}, nil},
+		{"unknown command", []string{"nope", ""}, nil},
+		{"flag names", []string{"browse", "--"}, []string{"--help", "--limit", "--feed", "--unread", "--since"}},
+		{"flag name prefix", []string{"browse", "--u"}, []string{"--unread"}},
+		{"flag values from choices", []string{"browse", "--feed", "go"}, []string{"go-blog", "golang-weekly"}},
+		{"flag values after =", []string{"browse", "--feed=r"}, []string{"--feed=rust"}},
+		{"flag value with a blank", []string{"browse", "--feed", "Rust"}, []string{"Rust Weekly"}},
+		{"flag value with a star", []string{"browse", "--feed", "C"}, []string{"C* digest"}},
+		{"flag without completer", []string{"browse", "--since", ""}, nil},
+		{"bool flag takes no value", []string{"browse", "--unread", ""}, nil},
+		{"positional argument", []string{"follow", "https://go"}, []string{"https://go.dev/blog/feed.atom"}},
+		{"positional argument after a flag", []string{"follow", "--sort", "url", "https://b"}, []string{"https://blog.rust-lang.org/feed.xml"}},
+		{"past the last argument", []string{"follow", "https://go.dev/blog/feed.atom", ""}, nil},
+		{"repeated argument", []string{"unfollow", "https://go.dev/blog/feed.atom", "h"}, []string{"https://go.dev/blog/feed.atom"}},
+		{"command without arguments", []string{"feeds", ""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.complete(context.Background(), nil, tt.words); !slices.Equal(got, tt.want) {
+				t.Errorf("complete(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+//the bash script keeps candidates with blanks and globs as one word each
+func TestBashCompletionScript(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	//a stand-in gator that prints the candidates __complete would
+	script := `gator() { printf '%s\n' 'Rust Weekly' 'C* digest' 'go-blog'; }
+` + completionScripts["bash"] + `
+COMP_WORDS=(gator browse --feed "")
+COMP_CWORD=3
+_gator
+printf '%s\n' "${COMPREPLY[@]}"
+`
+	out, err := exec.Command(bash, "--norc", "-c", script).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	want := []string{`Rust\ Weekly`, `C\*\ digest`, "go-blog"}
+	if !slices.Equal(got, want) {
+		t.Errorf("COMPREPLY = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+)
+
+//where a page of browse starts or ends: the sort key (published_at, id) of a post.
+//Printed as an opaque token so it can change without breaking scripts that pass it back
+type postCursor struct {
+	published sql.NullTime
+	id        uuid.UUID
+}
+
+func cursorOf(post database.GetPostsForUserRow) postCursor {
+	return postCursor{published: post.PublishedAt, id: post.ID}
+}
+
+func (cursor postCursor) String() string {
+	published := ""
+	if cursor.published.Valid {
+		published = cursor.published.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(published + "_" + cursor.id.String()))
+}
+
+func parseCursor(token string) (postCursor, error) {
+	invalid := invalidArgument("invalid cursor %q, pass one printed by browse", token)
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return postCursor{}, invalid
+	}
+	published, id, ok := strings.Cut(string(decoded), "_")
+	if !ok {
+		return postCursor{}, invalid
+	}
+	var cursor postCursor
+	if cursor.id, err = uuid.Parse(id); err != nil {
+		return postCursor{}, invalid
+	}
+	//empty for posts without a publish date
+	if published != "" {
+		t, err := time.Parse(time.RFC3339Nano, published)
+		if err != nil {
+			return postCursor{}, invalid
+		}
+		cursor.published = sql.NullTime{Time: t, Valid: true}
+	}
+	return cursor, nil
+}
+
+//the filters browse carries over to the other pages, in the order of its flags
+var browseFilterFlags = []string{"feed", "since", "from", "to", "match", "regex", "enclosure", "unread"}
+
+//the browse command for the page past cursor, direction is before or after. It keeps the
+//limit and the filters cmd was given so the page continues the same list
+func browsePageCommand(cmd command, limit int, direction string, cursor postCursor) string {
+	words := []string{"gator", "browse"}
+	if cmd.flagGiven("limit") || len(cmd.args) > 0 {
+		words = append(words, "--limit", strconv.Itoa(limit))
+	}
+	for _, name := range browseFilterFlags {
+		if !cmd.flagGiven(name) {
+			continue
+		}
+		switch value := cmd.flags[name].(type) {
+		case bool:
+			if value {
+				words = append(words, "--"+name)
+			}
+		case []string:
+			for _, v := range value {
+				words = append(words, "--"+name, shellQuote(v))
+			}
+		default:
+			words = append(words, "--"+name, shellQuote(fmt.Sprint(value)))
+		}
+	}
+	return strings.Join(append(words, "--"+direction, cursor.String()), " ")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseCursor(t *testing.T) {
+	id := uuid.MustParse("0b5c7c1e-8f4f-4a53-9a5e-2f1d3c4b5a69")
+	published := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	encode := func(text string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(text))
+	}
+	tests := []struct {
+		name    string
+		token   string
+		want    postCursor
+		wantErr bool
+	}{
+		{"dated post", postCursor{published: sql.NullTime{Time: published, Valid: true}, id: id}.String(),
+			postCursor{published: sql.NullTime{Time: published, Valid: true}, id: id}, false},
+		{"undated post", postCursor{id: id}.String(), postCursor{id: id}, false},
+		{"other time zones are kept as the same instant", encode("2024-05-01T14:30:00.123456789+02:00_" + id.String()),
+			postCursor{published: sql.NullTime{Time: published, Valid: true}, id: id}, false},
+		{"empty", "", postCursor{}, true},
+		{"not base64", "not a cursor!", postCursor{}, true},
+		{"no separator", encode(id.String()), postCursor{}, true},
+		{"bad id", encode("_not-a-uuid"), postCursor{}, true},
+		{"bad time", encode("yesterday_" + id.String()), postCursor{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCursor(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCursor(%q) error = %v, wantErr %v", tt.token, err, tt.wantErr)
+			}
+			if got.id != tt.want.id || got.published.Valid != tt.want.published.Valid || !got.published.Time.Equal(tt.want.published.Time) {
+				t.Errorf("parseCursor(%q) = %+v, want %+v", tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrowsePageCommand(t *testing.T) {
+	cursor := postCursor{id: uuid.MustParse("0b5c7c1e-8f4f-4a53-9a5e-2f1d3c4b5a69")}
+	defaults := map[string]any{
+		"limit": 2, "feed": []string(nil), "since": time.Duration(0), "from": "", "to": "",
+		"match": "", "regex": "", "enclosure": false, "unread": false, "before": "", "after": "", "page": 1,
+	}
+	with := func(args []string, given map[string]any) command {
+		cmd := command{name: "browse", args: args, flags: map[string]any{}, given: map[string]bool{}}
+		for name, value := range defaults {
+			cmd.flags[name] = value
+		}
+		for name, value := range given {
+			cmd.flags[name] = value
+			cmd.given[name] = true
+		}
+		return cmd
+	}
+	tests := []struct {
+		name      string
+		cmd       command
+		limit     int
+		direction string
+		want      string
+	}{
+		{"defaults", with(nil, nil), 2, "before", "gator browse --before " + cursor.String()},
+		{"positional limit", with([]string{"5"}, nil), 5, "before", "gator browse --limit 5 --before " + cursor.String()},
+		{"filters are kept", with(nil, map[string]any{
+			"limit": 20, "feed": []string{"go-blog", "Rust Weekly"}, "since": 24 * time.Hour, "match": "it's",
+			"enclosure": true, "unread": true,
+		}), 20, "after",
+			`gator browse --limit 20 --feed go-blog --feed 'Rust Weekly' --since 24h0m0s --match 'it'\''s' --enclosure --unread --after ` + cursor.String()},
+		{"page and cursors are left out", with(nil, map[string]any{"page": 3, "before": "abc"}), 2, "before",
+			"gator browse --before " + cursor.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := browsePageCommand(tt.cmd, tt.limit, tt.direction, cursor); got != tt.want {
+				t.Errorf("browsePageCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
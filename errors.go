@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+//what went wrong with a command, each kind exits with its own code so scripts can tell them apart
+type errorKind int
+
+const (
+	//anything else, e.g. the database is down
+	kindInternal errorKind = iota
+	kindInvalidArgument
+	kindNotFound
+	kindConflict
+	kindNotLoggedIn
+	//the command ran past its timeout
+	kindTimeout
+	//interrupted with Ctrl-C or SIGTERM
+	kindCancelled
+)
+
+//exit codes of gator, 0 is success
+var exitCodes = map[errorKind]int{
+	kindInternal:        1,
+	kindInvalidArgument: 2,
+	kindNotFound:        3,
+	kindConflict:        4,
+	kindNotLoggedIn:     5,
+	kindTimeout:         6,
+	kindCancelled:       130,
+}
+
+var kindNames = map[errorKind]string{
+	kindInternal:        "internal",
+	kindInvalidArgument: "invalid_argument",
+	kindNotFound:        "not_found",
+	kindConflict:        "conflict",
+	kindNotLoggedIn:     "not_logged_in",
+	kindTimeout:         "timeout",
+	kindCancelled:       "cancelled",
+}
+
+//an error returned by a handler, with the kind that decides the exit code
+type commandError struct {
+	kind    errorKind
+	message string
+	err     error
+}
+
+func (e *commandError) Error() string {
+	if e.err == nil {
+		return e.message
+	}
+	if e.message == "" {
+		return e.err.Error()
+	}
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+func invalidArgument(format string, args ...any) error {
+	return &commandError{kind: kindInvalidArgument, message: fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...any) error {
+	return &commandError{kind: kindNotFound, message: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...any) error {
+	return &commandError{kind: kindConflict, message: fmt.Sprintf(format, args...)}
+}
+
+func notLoggedIn(format string, args ...any) error {
+	return &commandError{kind: kindNotLoggedIn, message: fmt.Sprintf(format, args...)}
+}
+
+//wrap a database error, no rows become not-found, unique violations a conflict and
+//regular expressions Postgres rejects an invalid argument
+func dbError(err error, message string) error {
+	kind := kindInternal
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		kind = kindNotFound
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		kind = kindConflict
+	case errors.As(err, &pqErr) && pqErr.Code == "2201B":
+		kind = kindInvalidArgument
+	}
+	return &commandError{kind: kind, message: message, err: err}
+}
+
+//the kind of an error, internal unless a handler said otherwise or the context ran out
+func kindOf(err error) errorKind {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return kindTimeout
+	case errors.Is(err, context.Canceled):
+		return kindCancelled
+	}
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.kind
+	}
+	return kindInternal
+}
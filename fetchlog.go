@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+	"github.com/max-durnea/blog-aggregator/internal/sources"
+)
+
+//error texts longer than this are cut before they are stored
+const fetchLogMaxError = 1000
+
+//one run of scrapeFeeds for one feed, filled in as it goes and stored at the end
+type fetchAttempt struct {
+	feedID   uuid.UUID
+	feedType string
+	started  time.Time
+	meta    sources.FetchMeta
+	items   int
+	saved   saveStats
+	err     error
+	//agg was stopped mid-fetch and handed the feed back
+	released bool
+}
+
+func (a *fetchAttempt) record(s *state) {
+	params := database.CreateFetchAttemptParams{
+		ID:            uuid.New(),
+		FeedID:        a.feedID,
+		StartedAt:     a.started,
+		DurationMs:    int32(time.Since(a.started).Milliseconds()),
+		HttpStatus:    sql.NullInt32{Int32: int32(a.meta.StatusCode), Valid: a.meta.StatusCode != 0},
+		Bytes:         int32(a.meta.Bytes),
+		ItemsParsed:   int32(a.items),
+		PostsInserted: int32(a.saved.inserted),
+		PostsUpdated:  int32(a.saved.updated),
+		Duplicates:    int32(a.saved.duplicates),
+	}
+	if a.err != nil {
+		//errors can quote the response body, which may not be UTF-8 and postgres rejects that
+		message := strings.ToValidUTF8(a.err.Error(), "\uFFFD")
+		if len(message) > fetchLogMaxError {
+			cut := fetchLogMaxError
+			for cut > 0 && !utf8.RuneStart(message[cut]) {
+				cut--
+			}
+			message = message[:cut] + "..."
+		}
+		params.Error = sql.NullString{String: message, Valid: true}
+	}
+	//the attempt is recorded even if the fetch was cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := s.db.CreateFetchAttempt(ctx, params); err != nil {
+		slog.Error("Failed to record fetch attempt", "err", err)
+	}
+}
+
+//drop fetch attempts older than the retention so the table does not grow forever
+func pruneFetchLog(ctx context.Context, s *state, retention time.Duration) {
+	deleted, err := s.db.DeleteFetchAttemptsBefore(ctx, time.Now().Add(-retention))
+	if err != nil {
+		slog.Error("Failed to prune fetch log", "err", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Pruned fetch log", "deleted", deleted, "retention", retention)
+	}
+}
+
+//show recent fetch attempts, newest first: fetchlog [feed name|url] [--since 24h] [--limit 50]
+func handlerFetchLog(ctx context.Context, s *state, cmd command) error {
+	since := cmd.durationFlag("since")
+	limit := cmd.intFlag("limit")
+	if limit < 1 {
+		return invalidArgument("the limit must be at least 1")
+	}
+	var feedArg string
+	if len(cmd.args) > 0 {
+		feedArg = cmd.args[0]
+	}
+
+	params := database.GetFetchAttemptsParams{Since: time.Now().Add(-since), Limit: int32(limit)}
+	if feedArg != "" {
+		feed, err := lookupFeed(ctx, s, feedArg)
+		if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	attempts, err := s.db.GetFetchAttempts(ctx, params)
+	if err != nil {
+		return dbError(err, "could not fetch the fetch log")
+	}
+	if len(attempts) == 0 {
+		s.out.message("No fetch attempts in the last %v", since)
+	}
+	records := make([]fetchAttemptRecord, 0, len(attempts))
+	for _, attempt := range attempts {
+		records = append(records, newFetchAttemptRecord(attempt))
+	}
+	return writeList(s.out, records, func(w io.Writer, attempt fetchAttemptRecord) {
+		status := "-"
+		if attempt.HTTPStatus != nil {
+			status = fmt.Sprint(*attempt.HTTPStatus)
+		}
+		fmt.Fprintf(w, "%v  %v  status=%v  %vms  %vB  items=%v new=%v updated=%v dup=%v\n",
+			attempt.StartedAt.Format(time.DateTime), attempt.Feed, status, attempt.DurationMs,
+			attempt.Bytes, attempt.ItemsParsed, attempt.PostsInserted, attempt.PostsUpdated, attempt.Duplicates)
+		if attempt.Error != nil {
+			fmt.Fprintf(w, "    ! %v\n", *attempt.Error)
+		}
+	})
+}
+
+//find a feed by url, or by name if that is unambiguous
+func lookupFeed(ctx context.Context, s *state, nameOrURL string) (database.Feed, error) {
+	if strings.Contains(nameOrURL, "://") {
+		feed, err := s.db.GetFeedByUrl(ctx, nameOrURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Feed{}, notFound("no feed with url %v", nameOrURL)
+		}
+		if err != nil {
+			return database.Feed{}, dbError(err, "could not fetch feed "+nameOrURL)
+		}
+		return feed, nil
+	}
+	feeds, err := s.db.GetFeedsByName(ctx, nameOrURL)
+	if err != nil {
+		return database.Feed{}, dbError(err, "could not fetch feed "+nameOrURL)
+	}
+	if len(feeds) == 0 {
+		return database.Feed{}, notFound("no feed named %q", nameOrURL)
+	}
+	if len(feeds) > 1 {
+		return database.Feed{}, invalidArgument("%v feeds are named %q, use the url instead", len(feeds), nameOrURL)
+	}
+	return feeds[0], nil
+}
@@ -1,384 +1,771 @@
-package main
-
-import (
-	"fmt"
-	"os"
-	"time"
-	"context"
-	"net/http"
-	"encoding/xml"
-	"io"
-	"html"
-	"database/sql"
-	"strings"
-	"strconv"
-
-	"github.com/google/uuid"
-	"github.com/max-durnea/blog-aggregator/internal/database"
-)
-
-type RSSFeed struct {
-	Channel struct {
-		Title string `xml:"title"`
-		Link string `xml:"link"`
-		Description string `xml:"description"`
-		Item []RSSItem `xml:"item"`
-	} `xml:"channel"`
-}
-
-type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
-}
-
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error){
-	//Create the request with the provided URL and Context
-	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to create request: %v\n", err)
-		return nil, err
-	}
-	req.Header.Add("User-Agent","gator")
-	//Create a client and do the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to make HTTP request: %v\n", err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-	
-	//Read the bytes and unmarshal data into the RSSFeed struct
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to read response body: %v\n", err)
-		return nil, err
-	}
-	
-	var rssFeed RSSFeed
-	err = xml.Unmarshal(data,&rssFeed)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to unmarshal XML from %s: %v\n", feedURL, err)
-		fmt.Printf("Response content preview: %.200s...\n", string(data))
-		return nil, err
-	}
-	//Unescape strings
-	rssFeed.Channel.Title = html.UnescapeString(rssFeed.Channel.Title)
-	rssFeed.Channel.Description = html.UnescapeString(rssFeed.Channel.Description)
-
-	for i := range rssFeed.Channel.Item {
-		rssFeed.Channel.Item[i].Title = html.UnescapeString(rssFeed.Channel.Item[i].Title)
-		rssFeed.Channel.Item[i].Description = html.UnescapeString(rssFeed.Channel.Item[i].Description)
-	}
-	return &rssFeed,nil
-	
-}
-
-
-func parsePubDate(dateStr string) (time.Time, error) {
-    layouts := []string{
-        time.RFC1123,        
-        time.RFC1123Z,       
-        time.RFC3339,
-    }
-
-    for _, layout := range layouts {
-        t, err := time.Parse(layout, dateStr)
-        if err == nil {
-            return t, nil
-        }
-    }
-
-    return time.Time{}, fmt.Errorf("Unable to parse date: %s", dateStr)
-}
-
-func scrapeFeeds(s *state) error{
-	nextFeed,err:= s.db.GetNextFeedToFetch(context.Background())
-	if err != nil {
-		fmt.Printf("ERROR: Failed to fetch next feed: %v\n",err)
-		return nil
-	}
-	err=s.db.MarkFeedFetched(context.Background(), nextFeed.ID)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to mark feed as fetched: %v\n",err)
-		os.Exit(1)
-	}
-	feed,err := fetchFeed(context.Background(), nextFeed.Url)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to fetch feed from web: %v\n",err)
-		return nil
-	}
-
-	for _,item := range feed.Channel.Item{
-		pubTime,err := parsePubDate(item.PubDate)
-		if err != nil {
-			fmt.Println("ERROR: %v\n",err)
-		}
-		params := database.CreatePostParams{
-			ID : uuid.New(),
-			CreatedAt : time.Now(),
-			UpdatedAt : time.Now(),
-			Title : sql.NullString{item.Title, item.Title != ""},
-			Url : item.Link,
-			Description : sql.NullString{item.Description, item.Description != ""},
-			PublishedAt : sql.NullTime{pubTime, true},
-			FeedID : nextFeed.ID,
-		}
-		_, err = s.db.CreatePost(context.Background(),params)
-		if err != nil {
-			if strings.Contains(err.Error(), "unique constraint") || strings.Contains(err.Error(), "duplicate key") {
-				//fmt.Println("Post URL already exists, ignoring...")
-				continue
-			}
-			fmt.Println("ERROR: Could not insert new post: %v\n",err)
-			continue
-		}
-	}
-	
-	return nil
-
-}
-
-func agg(s *state, cmd command) error{
-	if len(cmd.args) != 1 {
-		fmt.Println("ERROR: Please provide the time between requests like: 1s 1m 1h")
-		os.Exit(1)
-	}
-	timeBetweenRequests, err := time.ParseDuration(cmd.args[0])
-	if err != nil {
-		fmt.Println("ERROR: Error parsing duration: %v\n",err)
-		os.Exit(1)
-	}
-	fmt.Printf("Scraping feeds every %v...\n",timeBetweenRequests)
-	ticker := time.NewTicker(timeBetweenRequests)
-	for ; ; <-ticker.C {
-		scrapeFeeds(s)
-	}
-	return nil
-}
-
-//middleware for functions that have to ensure the user is logged in
-func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(*state, command) error{
-	//we return a new function where we simply fetch the current user before calling our handler
-	return func(s *state,cmd command) error {
-		user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUserName)
-		if err != nil {
-			fmt.Printf("ERROR: Could not fetch user: %v\n",err)
-			os.Exit(1)
-		}
-		//the handlers need to accept the user struct
-		return handler(s, cmd, user)
-	}
-}
-
-func handlerFeed(s *state, cmd command, user database.User) error{
-	if len(cmd.args)!=2{
-		fmt.Println("ERROR: Wrong arguments, provide name and url!")
-		os.Exit(1)
-	}
-	/*user,err:=s.db.GetUser(context.Background(),s.cfg.CurrentUserName)
-	if err != nil {
-		fmt.Printf("ERROR: Could not get current user: %v\n", err)
-		os.Exit(1)
-	}*/
-	name:=cmd.args[0]
-	url:=cmd.args[1]
-	
-	params:=database.CreateFeedParams{uuid.New(),time.Now(),time.Now(),name,url,user.ID}
-	res,err:=s.db.CreateFeed(context.Background(),params)
-	if err != nil {
-		fmt.Printf("ERROR: Could not add feed entry: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Println(res)
-	handlerFollow(s,command{args: []string{url}},user)
-	return nil
-
-}
-
-func handlerAllFeeds(s *state, cmd command) error{
-	feeds,err:=s.db.GetFeeds(context.Background())
-	if err != nil {
-		fmt.Printf("ERROR: Could not fetch feeds: %v\n", err)
-		os.Exit(1)
-	}
-	for _, feed := range feeds {
-		user,err:=s.db.GetUserById(context.Background(),feed.UserID)
-		if err != nil {
-			fmt.Printf("ERROR: Could not fetch user by id: %v\n", err)
-			continue
-		}
-		fmt.Printf(" * %v\n * %v\n * %v\n---\n",feed.Name, feed.Url,user.Name)
-	}
-	return nil
-}
-
-func handlerFollow(s *state, cmd command, user database.User) error{
-	if len(cmd.args) != 1 {
-		fmt.Printf("ERROR: Wrong argument, provide the URL\n")
-		os.Exit(1)
-	}
-	feed,err:=s.db.GetFeedByUrl(context.Background(),cmd.args[0])
-	if err != nil {
-		fmt.Printf("ERROR: Could not fetch feed: %v\n",err)
-		os.Exit(1)
-	}
-	/*user,err:=s.db.GetUser(context.Background(),s.cfg.CurrentUserName)
-	if err != nil {
-		fmt.Printf("ERROR: Could not fetch current user: %v\n",err)
-		os.Exit(1)
-	}*/
-
-	params := database.CreateFeedFollowParams{uuid.New(),time.Now(),time.Now(),user.ID,feed.ID}
-	feed_follow,err:=s.db.CreateFeedFollow(context.Background(),params)
-	if err != nil {
-		fmt.Printf("ERROR: Could not create feed follow: %v\n",err)
-		os.Exit(1)
-	}
-	fmt.Printf("Added feed %v for user %v\n",feed_follow.FeedName,feed_follow.UserName)
-	return nil
-}
-
-func handlerFollows(s *state,cmd command, user database.User) error{
-	/*user,err:= s.db.GetUser(context.Background(),s.cfg.CurrentUserName)
-	if err != nil {
-		fmt.Printf("ERROR: Could not fetch user: %v\n", err)
-		os.Exit(1)
-	}*/
-	feeds, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
-	if err != nil {
-		fmt.Printf("ERROR: Could not fetch feeds: %v\n",err)
-		os.Exit(1)
-	}
-	fmt.Printf(" - %v\n",user.Name)
-	for _,feed := range feeds {
-		fmt.Printf(" * %v\n",feed.FeedName)
-	}
-	return nil
-
-}
-
-func handlerLogin(s *state, cmd command) error{
-	if len(cmd.args)==0 {
-		return fmt.Errorf("ERROR: Username not provided")
-	}
-	user,err:=s.db.GetUser(context.Background(),cmd.args[0])
-	if err != nil {
-		fmt.Printf("ERROR: User not found: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Println(user);
-	//Write to the config file the new Username
-	err=s.cfg.SetUser(cmd.args[0])
-	if err != nil {
-		return err
-	}
-	fmt.Println("User has been set successfuly!")
-	return nil
-}
-
-func handlerRegister(s *state, cmd command) error{
-	if len(cmd.args)==0 {
-		return fmt.Errorf("ERROR: Username not provided")
-	}
-	//build the param struct for a new user
-	params := database.CreateUserParams{uuid.New(),time.Now(),time.Now(),cmd.args[0]}
-	// use an empty context and create the user
-	user,err:=s.db.CreateUser(context.Background(),params)
-	if err != nil {
-		fmt.Printf("ERROR: User already exists: %v\n", err)
-		os.Exit(1)
-	}
-	// set the user session inside the config file
-	err = s.cfg.SetUser(cmd.args[0])
-	if err != nil {
-		fmt.Printf("ERROR: User could not be changed: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Println("User has been successfully created")
-	fmt.Printf("%v\n",user)
-	return nil
-}
-//function to reset database
-func handlerReset(s *state, cmd command) error {
-    // 1. Delete all posts first
-    if err := s.db.ResetPosts(context.Background()); err != nil {
-        fmt.Printf("ERROR: Failed to reset posts: %v\n", err)
-        os.Exit(1)
-    }
-
-    // 2. Delete all feeds
-    if err := s.db.ResetFeeds(context.Background()); err != nil {
-        fmt.Printf("ERROR: Failed to reset feeds: %v\n", err)
-        os.Exit(1)
-    }
-
-    // 3. Delete users
-    if err := s.db.ResetUsers(context.Background()); err != nil {
-        fmt.Printf("ERROR: Failed to reset users: %v\n", err)
-        os.Exit(1)
-    }
-
-    fmt.Println("Database has been reset successfully.")
-    return nil
-}
-
-//list all registered users from the database
-func handlerUsers(s *state, cmd command) error{
-	users, err := s.db.GetUsers(context.Background())
-	if err != nil {
-		fmt.Printf("ERROR: Could not get users: %v\n", err)
-		os.Exit(1)
-	}
-	for _,user := range users {
-		fmt.Printf("* %v",user.Name)
-		if s.cfg.CurrentUserName == user.Name{
-			fmt.Println(" (current)")
-		}else{
-			fmt.Println()
-		}
-		
-	}
-	return nil
-}
-
-func handlerUnfollow(s *state, cmd command, user database.User) error{
-	if len(cmd.args) != 1 {
-		fmt.Println("ERROR: Provide the URL\n")
-		os.Exit(1)
-	}
-	params := database.DeleteFeedFollowParams{user.Name,cmd.args[0]}
-	err:=s.db.DeleteFeedFollow(context.Background(),params)
-	if err != nil {
-		fmt.Printf("ERROR: Could not delete record: %v\n",err)
-		os.Exit(1)
-	}
-	fmt.Printf("User unsubscribed from %v\n",cmd.args[0])
-	return nil
-}
-
-func handlerBrowse(s *state, cmd command, user database.User) error{
-	var limit int32
-	if len(cmd.args) >= 1 {
-        parsed, err := strconv.ParseInt(cmd.args[0], 10, 32)
-        if err != nil {
-            fmt.Printf("ERROR: invalid number for limit: %v\n", err)
-            return err
-        }
-        limit = int32(parsed)
-	}else{
-		limit = 2
-	}
-	posts,err:= s.db.GetPostsForUser(context.Background(),database.GetPostsForUserParams{user.ID,limit})
-	if err != nil {
-		fmt.Printf("ERROR: Could not fetch posts for user: %v\n",err)
-		os.Exit(1)
-	}
-	for _,post := range posts {
-		fmt.Printf("* %v\n - %v\n = %v\n\n",post.Title.String,post.Description.String,post.Url)
-	}
-	return nil
-}
-
+package main
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"database/sql"
+	"strings"
+	"strconv"
+	"errors"
+	"sort"
+	"slices"
+	"sync"
+	"encoding/json"
+	"io"
+	"net/http"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+	"github.com/max-durnea/blog-aggregator/internal/sources"
+)
+
+//claim the feed that waited longest and fetch it within fetchTimeout, returns nil if there was
+//nothing to claim. Cancelling ctx aborts the fetch and hands the feed back for the next run.
+//Safe to run concurrently, every call claims a different feed
+func scrapeFeeds(ctx context.Context, s *state, fetchTimeout time.Duration) *fetchAttempt{
+	//feeds with a live WebSub lease are left to the hub, unless nobody listens for its pushes
+	nextFeed,err:= s.db.ClaimNextFeed(ctx, s.websub != nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		//every feed is currently delivered by a WebSub hub, or claimed by another worker
+		if s.health != nil {
+			s.health.progress()
+		}
+		return nil
+	}
+	if err != nil {
+		slog.Error("Failed to claim next feed", "err", err)
+		return nil
+	}
+	logger := slog.With("feed", nextFeed.Name, "feed_id", nextFeed.ID, "feed_type", nextFeed.FeedType)
+	//whatever happens from here on ends up in the fetch log
+	attempt := &fetchAttempt{feedID: nextFeed.ID, feedType: nextFeed.FeedType, started: time.Now()}
+	defer func() {
+		if ctx.Err() != nil {
+			//we were interrupted, let the next run pick this feed up first
+			attempt.released = true
+			releaseFeed(s, nextFeed)
+		}
+		attempt.record(s)
+		attempt.observe()
+		if s.health != nil {
+			s.health.progress()
+		}
+	}()
+
+	//a slow server or a hung database only costs this feed its turn
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	//the feed type decides how the feed is fetched and parsed
+	source, ok := sources.Lookup(nextFeed.FeedType)
+	if !ok {
+		attempt.err = fmt.Errorf("unknown feed type %q", nextFeed.FeedType)
+		logger.Error("Unknown feed type")
+		return attempt
+	}
+	//sources like page monitors keep state between fetches
+	feedState, err := s.db.GetFeedState(fetchCtx, nextFeed.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		attempt.err = err
+		logger.Error("Failed to load feed state", "err", err)
+		return attempt
+	}
+	feed,err := source.Fetch(fetchCtx, sources.Feed{URL: nextFeed.Url, Type: nextFeed.FeedType, Config: nextFeed.Config, State: feedState})
+	if feed != nil {
+		attempt.meta = feed.Meta
+	}
+	if err != nil {
+		attempt.err = err
+		logger.Error("Failed to fetch feed from web", "url", nextFeed.Url, "status", attempt.meta.StatusCode, "err", err)
+		return attempt
+	}
+	attempt.items = len(feed.Items)
+	attempt.saved, err = savePosts(fetchCtx, s, nextFeed.ID, feed)
+	if err != nil {
+		attempt.err = err
+		logger.Error("Failed to save posts", "err", err)
+		return attempt
+	}
+	logger.Info("Fetched feed", "status", attempt.meta.StatusCode, "items", attempt.items,
+		"inserted", attempt.saved.inserted, "updated", attempt.saved.updated, "duplicates", attempt.saved.duplicates, "duration", time.Since(attempt.started))
+
+	//if the feed has a hub and we run a callback server, stop polling it and subscribe instead.
+	//A hub that has not verified yet, failed or denied us is left alone until its backoff ends
+	if s.websub != nil && s.websub.renewalDue(nextFeed.ID) {
+		if hub := feed.Links["hub"]; hub != "" {
+			topic := feed.Links["self"]
+			if topic == "" {
+				topic = nextFeed.Url
+			}
+			if err := s.websub.subscribe(fetchCtx, s, nextFeed.ID, hub, topic); err != nil {
+				logger.Error("Failed to subscribe to hub", "hub", hub, "err", err)
+			}
+		}
+	}
+	return attempt
+
+}
+
+//undo the claim on a feed so it is first in line again
+func releaseFeed(s *state, feed database.ClaimNextFeedRow) {
+	//runs after the fetch was cancelled, so it gets a context of its own
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	err := s.db.ReleaseFeed(ctx, database.ReleaseFeedParams{ID: feed.ID, LastFetchedAt: feed.PreviousFetchedAt})
+	if err != nil {
+		slog.Error("Failed to release feed", "feed", feed.Name, "feed_id", feed.ID, "err", err)
+	}
+}
+
+//what happened to the items handed to savePosts
+type saveStats struct {
+	inserted   int
+	//items we already had, or that appeared twice in the feed
+	duplicates int
+	//items we already had that carried a newer date and refreshed the stored post
+	updated    int
+}
+
+//posts are sent to the database in batches of this many rows
+const savePostsBatch = 500
+
+//store the items of a feed as posts in one transaction, skipping the ones we already have
+//unless the source reports changes to them (sitemaps). The feed state, if any, is saved
+//in the same transaction so a failed insert does not lose a page change
+func savePosts(ctx context.Context, s *state, feedID uuid.UUID, feed *sources.Result) (saveStats, error) {
+	var stats saveStats
+	var batches []database.InsertPostsParams
+	var batch database.InsertPostsParams
+	seen := map[string]bool{}
+	for _,item := range feed.Items{
+		if item.Published.IsZero() && item.PublishedRaw != "" {
+			slog.Warn("Unable to parse date", "feed_id", feedID, "date", item.PublishedRaw, "url", item.Link)
+		}
+		//the url is unique, a second item with the same link would conflict with the first
+		if seen[item.Link] {
+			stats.duplicates++
+			continue
+		}
+		seen[item.Link] = true
+		if len(batch.Ids) == savePostsBatch {
+			batches = append(batches, batch)
+			batch = database.InsertPostsParams{}
+		}
+		batch.FeedID = feedID
+		batch.Ids = append(batch.Ids, uuid.New())
+		batch.Titles = append(batch.Titles, item.Title)
+		batch.Urls = append(batch.Urls, item.Link)
+		batch.Descriptions = append(batch.Descriptions, item.Description)
+		//the column has no zone and would keep the feed's wall time, store UTC instead
+		batch.PublishedAts = append(batch.PublishedAts, item.Published.UTC())
+		batch.EnclosureUrls = append(batch.EnclosureUrls, item.EnclosureURL)
+		batch.Contents = append(batch.Contents, item.Content)
+	}
+	if len(batch.Ids) > 0 {
+		batches = append(batches, batch)
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return saveStats{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := database.New(timedDB{db: tx})
+	for _, batch := range batches {
+		batch.UpdateExisting = feed.UpdatesPosts
+		ids, err := qtx.InsertPosts(ctx, batch)
+		if err != nil {
+			return saveStats{}, fmt.Errorf("could not insert posts: %w", err)
+		}
+		//an updated post keeps its old id, so only our new ids count as inserted
+		created := map[uuid.UUID]bool{}
+		for _, id := range batch.Ids {
+			created[id] = true
+		}
+		var updated []uuid.UUID
+		for _, id := range ids {
+			if created[id] {
+				stats.inserted++
+			} else {
+				updated = append(updated, id)
+			}
+		}
+		stats.updated += len(updated)
+		stats.duplicates += len(batch.Ids) - len(ids)
+		//posts are only updated when their date moved, show the change in browse --unread
+		if len(updated) > 0 {
+			if err := qtx.ClearPostReads(ctx, updated); err != nil {
+				return saveStats{}, fmt.Errorf("could not mark updated posts unread: %w", err)
+			}
+		}
+	}
+	if feed.State != nil {
+		err = qtx.SaveFeedState(ctx, database.SaveFeedStateParams{FeedID: feedID, State: *feed.State})
+		if err != nil {
+			return saveStats{}, fmt.Errorf("could not save feed state: %w", err)
+		}
+	}
+	//open readers hear about new posts once the transaction commits
+	if stats.inserted > 0 {
+		if err := qtx.NotifyPostsInserted(ctx, feedID); err != nil {
+			return saveStats{}, fmt.Errorf("could not notify about new posts: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return saveStats{}, fmt.Errorf("could not commit posts: %w", err)
+	}
+	postsInserted.Add(float64(stats.inserted))
+	postsUpdated.Add(float64(stats.updated))
+	duplicatesSkipped.Add(float64(stats.duplicates))
+	return stats, nil
+}
+
+//totals for the summary agg prints when it stops
+type aggSummary struct {
+	//workers add to the summary concurrently
+	mu         sync.Mutex
+	started    time.Time
+	fetched    int
+	failed     int
+	released   int
+	inserted   int
+	updated    int
+	duplicates int
+}
+
+func (sum *aggSummary) add(attempt *fetchAttempt) {
+	sum.mu.Lock()
+	defer sum.mu.Unlock()
+	switch {
+	case attempt.released:
+		sum.released++
+	case attempt.err != nil:
+		sum.failed++
+	default:
+		sum.fetched++
+	}
+	sum.inserted += attempt.saved.inserted
+	sum.updated += attempt.saved.updated
+	sum.duplicates += attempt.saved.duplicates
+}
+
+func agg(ctx context.Context, s *state, cmd command) error{
+	timeBetweenRequests, err := time.ParseDuration(cmd.args[0])
+	if err != nil {
+		return invalidArgument("invalid time between requests: %v", err)
+	}
+	//optional WebSub callback server, e.g. agg 1m --websub-listen :8080 --websub-callback https://example.com/websub
+	listenAddr := cmd.stringFlag("websub-listen")
+	callbackURL := cmd.stringFlag("websub-callback")
+	metricsAddr := cmd.stringFlag("metrics-addr")
+	livenessWindow := cmd.durationFlag("liveness-window")
+	fetchTimeout := cmd.durationFlag("fetch-timeout")
+	shutdownTimeout := cmd.durationFlag("shutdown-timeout")
+	workers := cmd.intFlag("workers")
+	if workers < 1 {
+		return invalidArgument("--workers must be at least 1")
+	}
+	retention, err := s.cfg.FetchLogRetentionDuration()
+	if err != nil {
+		return fmt.Errorf("invalid fetch_log_retention in config: %w", err)
+	}
+
+	//ctx is cancelled by SIGINT/SIGTERM: stop claiming feeds, the fetch in flight gets shutdownTimeout to finish
+	fetchCtx, cancelFetches := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelFetches()
+	go func() {
+		select {
+		case <-ctx.Done():
+			slog.Info("Shutting down, waiting for the current fetch", "timeout", shutdownTimeout)
+			time.AfterFunc(shutdownTimeout, cancelFetches)
+		case <-fetchCtx.Done():
+		}
+	}()
+
+	//a server that fails to start or dies stops agg
+	serverErr := make(chan error, 2)
+	if callbackURL != "" {
+		if listenAddr == "" {
+			listenAddr = ":8080"
+		}
+		s.websub, err = newWebSub(s, listenAddr, callbackURL)
+		if err != nil {
+			return invalidArgument("invalid WebSub callback URL: %v", err)
+		}
+		go func() {
+			if err := s.websub.listen(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- fmt.Errorf("WebSub callback server stopped: %w", err)
+			}
+		}()
+		slog.Info("Receiving WebSub pushes", "listen", listenAddr, "callback", callbackURL)
+	}
+	var metricsServer *http.Server
+	if metricsAddr != "" {
+		if livenessWindow == 0 {
+			livenessWindow = max(5*timeBetweenRequests, 5*time.Minute)
+		}
+		s.health = newAggHealth(livenessWindow)
+		metricsServer = newMetricsServer(metricsAddr, s)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- fmt.Errorf("metrics server stopped: %w", err)
+			}
+		}()
+		slog.Info("Serving /metrics, /healthz and /readyz", "listen", metricsAddr)
+	}
+	slog.Info("Scraping feeds", "every", timeBetweenRequests, "workers", workers)
+	summary := aggSummary{started: time.Now()}
+	ticker := time.NewTicker(timeBetweenRequests)
+	defer ticker.Stop()
+	var lastPrune time.Time
+	var failed error
+	for ctx.Err() == nil && failed == nil {
+		//every worker claims and fetches a feed of its own
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if attempt := scrapeFeeds(fetchCtx, s, fetchTimeout); attempt != nil {
+					summary.add(attempt)
+				}
+			}()
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			break
+		}
+		if time.Since(lastPrune) > time.Hour {
+			pruneFetchLog(fetchCtx, s, retention)
+			lastPrune = time.Now()
+		}
+		if s.websub != nil {
+			s.websub.renewLeases(fetchCtx, s)
+		}
+		if metricsServer != nil {
+			updateScheduleMetrics(fetchCtx, s, timeBetweenRequests, workers)
+		}
+		select {
+		case <-ctx.Done():
+		case failed = <-serverErr:
+		case <-ticker.C:
+		}
+	}
+
+	if s.websub != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := s.websub.shutdown(shutdownCtx); err != nil {
+			slog.Error("WebSub callback server did not stop cleanly", "err", err)
+		}
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	slog.Info("Stopped", "uptime", time.Since(summary.started).Round(time.Second), "fetched", summary.fetched,
+		"failed", summary.failed, "released", summary.released, "inserted", summary.inserted, "updated", summary.updated, "duplicates", summary.duplicates)
+	return failed
+}
+
+//middleware for functions that have to ensure the user is logged in
+func middlewareLoggedIn(handler func(ctx context.Context, s *state, cmd command, user database.User) error) func(context.Context, *state, command) error{
+	//we return a new function where we simply fetch the current user before calling our handler
+	return func(ctx context.Context, s *state,cmd command) error {
+		if s.cfg.CurrentUserName == "" {
+			return notLoggedIn("no user is logged in, use login or register first")
+		}
+		user, err := s.db.GetUser(ctx, s.cfg.CurrentUserName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return notLoggedIn("the logged in user %v no longer exists, use login or register", s.cfg.CurrentUserName)
+		}
+		if err != nil {
+			return dbError(err, "could not fetch user")
+		}
+		//the handlers need to accept the user struct
+		return handler(ctx, s, cmd, user)
+	}
+}
+
+func handlerFeed(ctx context.Context, s *state, cmd command, user database.User) error{
+	if len(cmd.args)<2{
+		return invalidArgument("provide name, url and optionally the feed type (%v) followed by key=value settings", strings.Join(sources.Types(), ", "))
+	}
+	name:=cmd.args[0]
+	url:=cmd.args[1]
+	feedType := sources.TypeRSS
+	if strings.HasPrefix(url, sources.FilePrefix) {
+		feedType = sources.TypeFile
+		fileURL, err := normalizeFileFeedURL(url)
+		if err != nil {
+			return invalidArgument("invalid feed file: %v", err)
+		}
+		url = fileURL
+	}
+	if len(cmd.args) >= 3 {
+		feedType = cmd.args[2]
+	}
+	source, ok := sources.Lookup(feedType)
+	if !ok {
+		return invalidArgument("unknown feed type %q, use one of: %v", feedType, strings.Join(sources.Types(), ", "))
+	}
+	//anything after the type is source specific, e.g. item=.release title=h2 for html feeds
+	settings := map[string]string{}
+	for _, arg := range cmd.args[min(len(cmd.args), 3):] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return invalidArgument("feed settings must look like key=value, got %q", arg)
+		}
+		settings[key] = value
+	}
+	feedConfig, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("could not encode feed settings: %w", err)
+	}
+	if validator, ok := source.(sources.ConfigValidator); ok {
+		if err := validator.ValidateConfig(feedConfig); err != nil {
+			return invalidArgument("invalid %v feed settings: %v", feedType, err)
+		}
+	} else if len(settings) > 0 {
+		return invalidArgument("%v feeds take no settings", feedType)
+	}
+	
+	params:=database.CreateFeedParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Name: name, Url: url, UserID: user.ID, FeedType: feedType, Config: feedConfig}
+	res,err:=s.db.CreateFeed(ctx,params)
+	if err != nil {
+		return dbError(err, "could not add feed "+url)
+	}
+	if _, err := followFeed(ctx, s, user, res); err != nil {
+		return err
+	}
+	return writeRecord(s.out, newFeedRecord(res, user.Name), func(w io.Writer, feed feedRecord) {
+		fmt.Fprintf(w, "Added feed %v (%v) for user %v\n", feed.Name, feed.URL, feed.AddedBy)
+	})
+}
+
+//list all feeds: feeds [--sort name|url|created]
+func handlerAllFeeds(ctx context.Context, s *state, cmd command) error{
+	feeds,err:=s.db.GetFeeds(ctx)
+	if err != nil {
+		return dbError(err, "could not fetch feeds")
+	}
+	switch sortBy := cmd.stringFlag("sort"); sortBy {
+	case "name":
+		sort.SliceStable(feeds, func(i, j int) bool { return feeds[i].Name < feeds[j].Name })
+	case "url":
+		sort.SliceStable(feeds, func(i, j int) bool { return feeds[i].Url < feeds[j].Url })
+	case "created":
+		sort.SliceStable(feeds, func(i, j int) bool { return feeds[i].CreatedAt.Before(feeds[j].CreatedAt) })
+	default:
+		return invalidArgument("invalid --sort %q, use name, url or created", sortBy)
+	}
+	records := make([]feedRecord, 0, len(feeds))
+	for _, feed := range feeds {
+		user,err:=s.db.GetUserById(ctx,feed.UserID)
+		if err != nil {
+			slog.Error("Could not fetch user by id", "err", err)
+			continue
+		}
+		records = append(records, newFeedRecord(feed, user.Name))
+	}
+	return writeList(s.out, records, func(w io.Writer, feed feedRecord) {
+		fmt.Fprintf(w, " * %v\n * %v\n * %v\n---\n",feed.Name, feed.URL,feed.AddedBy)
+	})
+}
+
+func handlerFollow(ctx context.Context, s *state, cmd command, user database.User) error{
+	if len(cmd.args) != 1 {
+		return invalidArgument("provide the URL")
+	}
+	feed,err:=s.db.GetFeedByUrl(ctx,cmd.args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound("no feed with url %v, add it with addfeed first", cmd.args[0])
+	}
+	if err != nil {
+		return dbError(err, "could not fetch feed")
+	}
+	record, err := followFeed(ctx, s, user, feed)
+	if err != nil {
+		return err
+	}
+	return writeRecord(s.out, record, func(w io.Writer, follow followRecord) {
+		fmt.Fprintf(w, "Added feed %v for user %v\n",follow.FeedName,follow.User)
+	})
+}
+
+//make user follow feed, for follow and addfeed
+func followFeed(ctx context.Context, s *state, user database.User, feed database.Feed) (followRecord, error) {
+	params := database.CreateFeedFollowParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedID: feed.ID}
+	feed_follow,err:=s.db.CreateFeedFollow(ctx,params)
+	if err != nil {
+		return followRecord{}, dbError(err, "could not follow "+feed.Name)
+	}
+	return followRecord{FeedID: feed.ID, FeedName: feed_follow.FeedName, FeedURL: feed.Url, User: feed_follow.UserName, FollowedAt: feed_follow.CreatedAt}, nil
+}
+
+func handlerFollows(ctx context.Context, s *state, cmd command, user database.User) error{
+	feeds, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+	if err != nil {
+		return dbError(err, "could not fetch feeds")
+	}
+	records := make([]followRecord, 0, len(feeds))
+	for _,feed := range feeds {
+		records = append(records, followRecord{FeedID: feed.FeedID, FeedName: feed.FeedName, FeedURL: feed.FeedUrl, User: feed.UserName, FollowedAt: feed.CreatedAt})
+	}
+	s.out.message(" - %v",user.Name)
+	return writeList(s.out, records, func(w io.Writer, follow followRecord) {
+		fmt.Fprintf(w, " * %v\n",follow.FeedName)
+	})
+}
+
+func handlerLogin(ctx context.Context, s *state, cmd command) error{
+	if len(cmd.args)==0 {
+		return invalidArgument("username not provided")
+	}
+	user,err:=s.db.GetUser(ctx,cmd.args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound("user %v not found", cmd.args[0])
+	}
+	if err != nil {
+		return dbError(err, "could not fetch user")
+	}
+	//Write to the config file the new Username
+	err=s.cfg.SetUser(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("could not save the current user: %w", err)
+	}
+	s.cfg.CurrentUserName = user.Name
+	return writeRecord(s.out, newUserRecord(user, s.cfg.CurrentUserName), func(w io.Writer, user userRecord) {
+		fmt.Fprintf(w, "Logged in as %v\n", user.Name)
+	})
+}
+
+func handlerRegister(ctx context.Context, s *state, cmd command) error{
+	if len(cmd.args)==0 {
+		return invalidArgument("username not provided")
+	}
+	//build the param struct for a new user
+	params := database.CreateUserParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Name: cmd.args[0]}
+	// use an empty context and create the user
+	user,err:=s.db.CreateUser(ctx,params)
+	if err != nil {
+		return dbError(err, "could not create user "+cmd.args[0])
+	}
+	// set the user session inside the config file
+	err = s.cfg.SetUser(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("could not save the current user: %w", err)
+	}
+	s.cfg.CurrentUserName = user.Name
+	return writeRecord(s.out, newUserRecord(user, s.cfg.CurrentUserName), func(w io.Writer, user userRecord) {
+		fmt.Fprintf(w, "Created user %v and logged in\n", user.Name)
+	})
+}
+//function to reset database
+func handlerReset(ctx context.Context, s *state, cmd command) error {
+    // 1. Delete all posts first
+    if err := s.db.ResetPosts(ctx); err != nil {
+        return dbError(err, "failed to reset posts")
+    }
+
+    // 2. Delete all feeds
+    if err := s.db.ResetFeeds(ctx); err != nil {
+        return dbError(err, "failed to reset feeds")
+    }
+
+    // 3. Delete users
+    if err := s.db.ResetUsers(ctx); err != nil {
+        return dbError(err, "failed to reset users")
+    }
+
+    s.out.message("Database has been reset successfully.")
+    return nil
+}
+
+//list all registered users from the database
+func handlerUsers(ctx context.Context, s *state, cmd command) error{
+	users, err := s.db.GetUsers(ctx)
+	if err != nil {
+		return dbError(err, "could not get users")
+	}
+	records := make([]userRecord, 0, len(users))
+	for _,user := range users {
+		records = append(records, newUserRecord(user, s.cfg.CurrentUserName))
+	}
+	return writeList(s.out, records, func(w io.Writer, user userRecord) {
+		fmt.Fprintf(w, "* %v",user.Name)
+		if user.Current {
+			fmt.Fprintln(w, " (current)")
+		}else{
+			fmt.Fprintln(w)
+		}
+	})
+}
+
+func handlerUnfollow(ctx context.Context, s *state, cmd command, user database.User) error{
+	if len(cmd.args) != 1 {
+		return invalidArgument("provide the URL")
+	}
+	params := database.DeleteFeedFollowParams{Name: user.Name, Url: cmd.args[0]}
+	deleted, err := s.db.DeleteFeedFollow(ctx, params)
+	if err != nil {
+		return dbError(err, "could not unfollow "+cmd.args[0])
+	}
+	if deleted == 0 {
+		return notFound("you do not follow %v", cmd.args[0])
+	}
+	s.out.message("User unsubscribed from %v",cmd.args[0])
+	return nil
+}
+
+//a date for browse --from and --to, 2024-05-01 or RFC 3339. A day without a time
+//ends at midnight after it when it is the upper bound, so --to includes the whole day
+func parseBrowseDate(text string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, text); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return time.Time{}, invalidArgument("invalid date %q, use 2006-01-02 or 2006-01-02T15:04:05Z07:00", text)
+	}
+	//posts are stored in UTC without a zone, see savePosts
+	return t.UTC(), nil
+}
+
+//show the latest posts of the followed feeds and mark them read:
+//browse [limit] [--limit n] [--feed name|url]... [--since 24h] [--from date] [--to date]
+//[--match text] [--regex re] [--enclosure] [--unread] [--before|--after cursor] [--page n]
+func handlerBrowse(ctx context.Context, s *state, cmd command, user database.User) error{
+	limit := cmd.intFlag("limit")
+	//the limit used to be positional, keep accepting it
+	if len(cmd.args) >= 1 {
+		parsed, err := strconv.Atoi(cmd.args[0])
+		if err != nil {
+			return invalidArgument("invalid number for limit: %v", cmd.args[0])
+		}
+		limit = parsed
+	}
+	if limit < 1 {
+		return invalidArgument("the limit must be at least 1")
+	}
+	page := cmd.intFlag("page")
+	if page < 1 {
+		return invalidArgument("the page must be at least 1")
+	}
+	if page > 1 && cmd.boolFlag("unread") {
+		//the pages before were marked read when they were shown, counting pages would skip posts
+		return invalidArgument("--page does not work with --unread, follow the Next page cursor instead")
+	}
+	//one more post than asked for tells whether there is a next page
+	params := database.GetPostsForUserParams{
+		UserID: user.ID,
+		Unread: cmd.boolFlag("unread"),
+		Offset: int32((page - 1) * limit),
+		Limit:  int32(limit + 1),
+	}
+	for _, name := range cmd.stringsFlag("feed") {
+		feed, err := lookupFeed(ctx, s, name)
+		if err != nil {
+			return err
+		}
+		params.FeedIds = append(params.FeedIds, feed.ID)
+	}
+	if since := cmd.durationFlag("since"); since > 0 {
+		params.Since = sql.NullTime{Time: time.Now().UTC().Add(-since), Valid: true}
+	}
+	if from := cmd.stringFlag("from"); from != "" {
+		t, err := parseBrowseDate(from, false)
+		if err != nil {
+			return err
+		}
+		//--since and --from both set a lower bound, the later one wins
+		if !params.Since.Valid || t.After(params.Since.Time) {
+			params.Since = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	if to := cmd.stringFlag("to"); to != "" {
+		t, err := parseBrowseDate(to, true)
+		if err != nil {
+			return err
+		}
+		params.Until = sql.NullTime{Time: t, Valid: true}
+	}
+	if match := cmd.stringFlag("match"); match != "" {
+		params.Match = sql.NullString{String: match, Valid: true}
+	}
+	if regex := cmd.stringFlag("regex"); regex != "" {
+		params.Regex = sql.NullString{String: regex, Valid: true}
+	}
+	params.HasEnclosure = cmd.boolFlag("enclosure")
+	before, after := cmd.stringFlag("before"), cmd.stringFlag("after")
+	if before != "" && after != "" {
+		return invalidArgument("use either --before or --after, not both")
+	}
+	if token := before + after; token != "" {
+		cursor, err := parseCursor(token)
+		if err != nil {
+			return err
+		}
+		params.CursorID = uuid.NullUUID{UUID: cursor.id, Valid: true}
+		params.CursorPublished = cursor.published
+	}
+	var posts []database.GetPostsForUserRow
+	var err error
+	if after != "" {
+		var rows []database.GetPostsForUserAfterRow
+		rows, err = s.db.GetPostsForUserAfter(ctx, database.GetPostsForUserAfterParams(params))
+		for _, row := range rows {
+			posts = append(posts, database.GetPostsForUserRow(row))
+		}
+	} else {
+		posts, err = s.db.GetPostsForUser(ctx, params)
+	}
+	if err != nil {
+		return dbError(err, "could not fetch posts for user")
+	}
+	more := len(posts) > limit
+	if more {
+		posts = posts[:limit]
+	}
+	if after != "" {
+		//the page right after the cursor came oldest first, show it newest first like the others
+		slices.Reverse(posts)
+	}
+	ids := make([]uuid.UUID, 0, len(posts))
+	records := make([]postRecord, 0, len(posts))
+	for _,post := range posts {
+		ids = append(ids, post.ID)
+		records = append(records, newPostRecord(post))
+	}
+	if s.session != nil {
+		s.session.posts = records
+	}
+	marker := postMarkers(s)
+	err = writeList(s.out, records, func(w io.Writer, post postRecord) {
+		fmt.Fprintf(w, "%v %v\n - %v\n = %v\n\n",marker(),post.Title,post.Description,post.URL)
+	})
+	if err != nil {
+		return err
+	}
+	//"more" is about the direction the page was read in, past a cursor there is always its post
+	older, newer := more, before != "" || page > 1
+	if after != "" {
+		older, newer = true, more
+	}
+	if len(posts) > 0 && older {
+		s.out.message("Next page: %v", browsePageCommand(cmd, limit, "before", cursorOf(posts[len(posts)-1])))
+	}
+	//with --unread the newer posts were marked read when they were shown, going back lists none of them
+	if len(posts) > 0 && newer && !params.Unread {
+		s.out.message("Previous page: %v", browsePageCommand(cmd, limit, "after", cursorOf(posts[0])))
+	}
+	//what was shown counts as read for --unread
+	if err := s.db.MarkPostsRead(ctx, database.MarkPostsReadParams{UserID: user.ID, PostIds: ids}); err != nil {
+		return dbError(err, "could not mark posts read")
+	}
+	return nil
+}
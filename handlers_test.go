@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/max-durnea/blog-aggregator/internal/config"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+	"github.com/max-durnea/blog-aggregator/internal/sources"
+)
+
+//a state on the database named by GATOR_TEST_DB_URL, emptied first. It must be a
+//migrated scratch database, everything in it is deleted
+func newTestState(t *testing.T) (*state, *sql.DB) {
+	t.Helper()
+	dbURL := os.Getenv("GATOR_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("set GATOR_TEST_DB_URL to a migrated scratch database to run")
+	}
+	conn, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s := &state{db: database.New(conn), conn: conn, cfg: &config.Config{}}
+	for _, reset := range []func(context.Context) error{s.db.ResetPosts, s.db.ResetFeeds, s.db.ResetUsers} {
+		if err := reset(context.Background()); err != nil {
+			t.Fatalf("could not reset the database: %v", err)
+		}
+	}
+	return s, conn
+}
+
+//an rss feed at url, added by a new user
+func createTestFeed(t *testing.T, s *state, url string) database.Feed {
+	t.Helper()
+	ctx := context.Background()
+	user, err := s.db.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Name: "test-" + uuid.NewString()[:8]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := s.db.CreateFeed(ctx, database.CreateFeedParams{
+		ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Name: "test", Url: url,
+		UserID: user.ID, FeedType: "rss", Config: json.RawMessage("{}"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func TestSavePostsStoresUndatedItemsWithoutADate(t *testing.T) {
+	ctx := context.Background()
+	s, conn := newTestState(t)
+	feed := createTestFeed(t, s, "https://example.com/feed.xml")
+	published := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	result := &sources.Result{Items: []sources.Item{
+		{Title: "Dated", Link: "https://example.com/dated", PublishedRaw: published.Format(time.RFC1123), Published: published},
+		{Title: "Undated", Link: "https://example.com/undated"},
+		{Title: "Bad date", Link: "https://example.com/bad-date", PublishedRaw: "yesterday"},
+	}}
+	saved, err := savePosts(ctx, s, feed.ID, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.inserted != 3 {
+		t.Fatalf("inserted %v posts, want 3", saved.inserted)
+	}
+	want := map[string]sql.NullTime{
+		"https://example.com/dated":    {Time: published, Valid: true},
+		"https://example.com/undated":  {},
+		"https://example.com/bad-date": {},
+	}
+	for url, wantPublished := range want {
+		var got sql.NullTime
+		if err := conn.QueryRow("SELECT published_at FROM posts WHERE url = $1", url).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Valid != wantPublished.Valid || !got.Time.Equal(wantPublished.Time) {
+			t.Errorf("%v stored with published_at %+v, want %+v", url, got, wantPublished)
+		}
+	}
+}
+
+//a pubDate with an offset is stored as the same instant in UTC, so browse --from and --since agree
+func TestSavePostsStoresDatesInUTC(t *testing.T) {
+	ctx := context.Background()
+	s, conn := newTestState(t)
+	feed := createTestFeed(t, s, "https://example.com/feed.xml")
+	result, err := sources.ParseRSS([]byte(`<rss version="2.0"><channel><title>Test</title>
+<item><title>Offset</title><link>https://example.com/offset</link><pubDate>Wed, 01 May 2024 12:00:00 +0200</pubDate></item>
+</channel></rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := savePosts(ctx, s, feed.ID, result); err != nil {
+		t.Fatal(err)
+	}
+	var got time.Time
+	if err := conn.QueryRow("SELECT published_at FROM posts WHERE url = $1", "https://example.com/offset").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Fatalf("stored published_at %v, want %v", got, want)
+	}
+}
+
+//a sitemap post whose lastmod moved is unread again, one that did not move or has no lastmod
+//keeps its read state
+func TestSavePostsMarksUpdatedPostsUnread(t *testing.T) {
+	ctx := context.Background()
+	s, conn := newTestState(t)
+	feed := createTestFeed(t, s, "https://example.com/sitemap.xml")
+	first := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	items := func(changed time.Time) *sources.Result {
+		return &sources.Result{UpdatesPosts: true, Items: []sources.Item{
+			{Title: "Changed", Link: "https://example.com/changed", Published: changed},
+			{Title: "Same", Link: "https://example.com/same", Published: first},
+			{Title: "Undated", Link: "https://example.com/undated"},
+		}}
+	}
+	if _, err := savePosts(ctx, s, feed.ID, items(first)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := conn.Exec("INSERT INTO post_reads(user_id, post_id, read_at) SELECT $1, id, NOW() FROM posts WHERE feed_id = $2", feed.UserID, feed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := savePosts(ctx, s, feed.ID, items(first.AddDate(0, 0, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.updated != 1 {
+		t.Fatalf("updated %v posts, want 1", saved.updated)
+	}
+	for url, wantRead := range map[string]bool{
+		"https://example.com/changed": false,
+		"https://example.com/same":    true,
+		"https://example.com/undated": true,
+	} {
+		var read bool
+		err := conn.QueryRow("SELECT EXISTS (SELECT 1 FROM post_reads r JOIN posts p ON p.id = r.post_id WHERE p.url = $1)", url).Scan(&read)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read != wantRead {
+			t.Errorf("%v read = %v, want %v", url, read, wantRead)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+//the newest migration in sql/schema, bump it when adding one
+const schemaVersion = 18
+
+//how long /readyz waits for the database
+const readinessTimeout = 2 * time.Second
+
+//liveness of a running agg: it is alive while feeds keep being processed
+type aggHealth struct {
+	window time.Duration
+	//unix nanoseconds of the last processed feed, or of the start of agg
+	lastProgress atomic.Int64
+}
+
+func newAggHealth(window time.Duration) *aggHealth {
+	h := &aggHealth{window: window}
+	h.progress()
+	return h
+}
+
+//a feed was processed, or there was no feed to process
+func (h *aggHealth) progress() {
+	h.lastProgress.Store(time.Now().UnixNano())
+}
+
+func (h *aggHealth) sinceProgress() time.Duration {
+	return time.Since(time.Unix(0, h.lastProgress.Load()))
+}
+
+//200 while agg processed a feed within the liveness window, 503 when it looks stuck
+func (h *aggHealth) handleLiveness(rw http.ResponseWriter, r *http.Request) {
+	since := h.sinceProgress().Round(time.Second)
+	if since > h.window {
+		http.Error(rw, fmt.Sprintf("no feed processed for %v (window %v)", since, h.window), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(rw, "ok, last feed processed %v ago\n", since)
+}
+
+//200 when the database is reachable and migrated to the schema this build expects
+func handleReadiness(s *state) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := s.conn.PingContext(ctx); err != nil {
+			http.Error(rw, fmt.Sprintf("database unreachable: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		//goose records every migration it applied
+		var version int64
+		err := s.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied").Scan(&version)
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("could not read schema version: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		if version < schemaVersion {
+			http.Error(rw, fmt.Sprintf("schema version %v, need %v: run the migrations", version, schemaVersion), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(rw, "ok, schema version %v\n", version)
+	}
+}
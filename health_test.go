@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//schemaVersion has to follow the migrations, or /readyz reports the wrong version
+func TestSchemaVersionIsTheNewestMigration(t *testing.T) {
+	entries, err := os.ReadDir("sql/schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest := 0
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			t.Fatalf("migration %v does not start with its version", entry.Name())
+		}
+		newest = max(newest, version)
+	}
+	if schemaVersion != newest {
+		t.Errorf("schemaVersion is %v but the newest migration is %v, bump it in health.go", schemaVersion, newest)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/max-durnea/blog-aggregator/internal/sources"
+)
+
+//turn file://relative/feed.xml into file:///abs/feed.xml so agg can read it from any directory
+func normalizeFileFeedURL(feedURL string) (string, error) {
+	path, err := filepath.Abs(strings.TrimPrefix(feedURL, sources.FilePrefix))
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	return sources.FilePrefix + path, nil
+}
+
+//read a feed document once from stdin (or a file) and store its posts under an existing feed:
+//ingest - [feed_url]. Without feed_url the document's self link picks the feed.
+func handlerIngest(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) < 1 || len(cmd.args) > 2 {
+		return invalidArgument("provide - (stdin) or a file and optionally the feed url")
+	}
+	var data []byte
+	var err error
+	if cmd.args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(strings.TrimPrefix(cmd.args[0], sources.FilePrefix))
+	}
+	if err != nil {
+		return fmt.Errorf("could not read feed document: %w", err)
+	}
+	feed, err := sources.Parse(data)
+	if err != nil {
+		return invalidArgument("could not parse feed document: %v", err)
+	}
+
+	feedURL := feed.Links["self"]
+	if len(cmd.args) == 2 {
+		feedURL = cmd.args[1]
+	}
+	if feedURL == "" {
+		return invalidArgument("the document has no self link, provide the feed url")
+	}
+	if strings.HasPrefix(feedURL, sources.FilePrefix) {
+		//the feed was added with an absolute path, match it the same way
+		if abs, err := filepath.Abs(strings.TrimPrefix(feedURL, sources.FilePrefix)); err == nil {
+			feedURL = sources.FilePrefix + abs
+		}
+	}
+	dbFeed, err := s.db.GetFeedByUrl(ctx, feedURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound("no feed with url %v, add it with addfeed first", feedURL)
+	}
+	if err != nil {
+		return dbError(err, "could not fetch feed "+feedURL)
+	}
+	saved, err := savePosts(ctx, s, dbFeed.ID, feed)
+	if err != nil {
+		return err
+	}
+	if err := s.db.MarkFeedFetched(ctx, dbFeed.ID); err != nil {
+		return dbError(err, "failed to mark feed as fetched")
+	}
+	record := ingestRecord{Feed: dbFeed.Name, FeedURL: dbFeed.Url, Items: len(feed.Items), Inserted: saved.inserted, Updated: saved.updated, Duplicates: saved.duplicates}
+	return writeRecord(s.out, record, func(w io.Writer, ingested ingestRecord) {
+		fmt.Fprintf(w, "Ingested %v items into %v: %v new, %v updated, %v skipped\n", ingested.Items, ingested.Feed, ingested.Inserted, ingested.Updated, ingested.Duplicates)
+	})
+}
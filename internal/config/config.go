@@ -1,60 +1,95 @@
-package config
-import(
-	"os"
-	//"fmt"
-	"encoding/json"
-)
-
-//A special struct to store the config file data which allows us to edit the file easily
-type Config struct{
-	DB_url string `json:"db_url"`
-	CurrentUserName string `json:"current_user_name"`
-}
-
-const configFileName = ".gatorconfig.json"
-
-
-func Read() (Config,error){
-	//find the home directory because the config file is stored by default inside the home directory
-	homedir,err := os.UserHomeDir()
-	if err != nil{
-		return Config{}, err
-	}
-	//build the path to the file
-	file:=homedir+"/"+configFileName
-	if err != nil{
-		return Config{}, err
-	}
-	//read file contents as a string
-	contents,err := os.ReadFile(file)
-	if err != nil {
-		return Config{}, err
-	}
-	//unmarshal the contents into a Config struct
-	var cfg Config
-	err = json.Unmarshal(contents,&cfg)
-	if err != nil {
-		return Config{}, err
-	}
-	return cfg,nil
-}
-
-func (cfg Config)SetUser(username string) error{
-	//edit the config struct with the specified username
-	cfg.CurrentUserName=username
-	homedir,err:=os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-	file:= homedir+"/"+configFileName
-	//build the byte slice of the Config struct
-	js,err:= json.Marshal(cfg)
-	if err != nil {
-		return err
-	}
-	//write the slice to the file 0666 is used to allow any user to read and write to the file but not execute it
-	if err := os.WriteFile(file, js,0666); err != nil {
-		return err
-	}
-	return nil
-}
+package config
+import(
+	"os"
+	//"fmt"
+	"encoding/json"
+	"time"
+)
+
+//A special struct to store the config file data which allows us to edit the file easily
+type Config struct{
+	DB_url string `json:"db_url"`
+	CurrentUserName string `json:"current_user_name"`
+	//how long fetch attempts are kept, as a Go duration like "720h"
+	FetchLogRetention string `json:"fetch_log_retention,omitempty"`
+	//debug, info, warn or error
+	LogLevel string `json:"log_level,omitempty"`
+	//text or json
+	LogFormat string `json:"log_format,omitempty"`
+	//logs go to stderr unless a file is set
+	LogFile string `json:"log_file,omitempty"`
+	//how long a command may run before it is cancelled, as a Go duration, "0" for no limit
+	CommandTimeout string `json:"command_timeout,omitempty"`
+	//text, json, jsonl, csv or table
+	Output string `json:"output,omitempty"`
+	//the Postgres text search configuration of search, like english or german
+	SearchLanguage string `json:"search_language,omitempty"`
+}
+
+const configFileName = ".gatorconfig.json"
+
+const defaultFetchLogRetention = 30 * 24 * time.Hour
+
+const defaultCommandTimeout = time.Minute
+
+
+func Read() (Config,error){
+	//find the home directory because the config file is stored by default inside the home directory
+	homedir,err := os.UserHomeDir()
+	if err != nil{
+		return Config{}, err
+	}
+	//build the path to the file
+	file:=homedir+"/"+configFileName
+	if err != nil{
+		return Config{}, err
+	}
+	//read file contents as a string
+	contents,err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+	//unmarshal the contents into a Config struct
+	var cfg Config
+	err = json.Unmarshal(contents,&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+	return cfg,nil
+}
+
+func (cfg Config)SetUser(username string) error{
+	//edit the config struct with the specified username
+	cfg.CurrentUserName=username
+	homedir,err:=os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	file:= homedir+"/"+configFileName
+	//build the byte slice of the Config struct
+	js,err:= json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	//write the slice to the file 0666 is used to allow any user to read and write to the file but not execute it
+	if err := os.WriteFile(file, js,0666); err != nil {
+		return err
+	}
+	return nil
+}
+
+//the fetch log retention from the config, 30 days if it is not set
+func (cfg Config) FetchLogRetentionDuration() (time.Duration, error){
+	if cfg.FetchLogRetention == "" {
+		return defaultFetchLogRetention, nil
+	}
+	return time.ParseDuration(cfg.FetchLogRetention)
+}
+
+//the per-command timeout from the config, a minute if it is not set
+func (cfg Config) CommandTimeoutDuration() (time.Duration, error){
+	if cfg.CommandTimeout == "" {
+		return defaultCommandTimeout, nil
+	}
+	return time.ParseDuration(cfg.CommandTimeout)
+}
@@ -7,22 +7,76 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimNextFeed = `-- name: ClaimNextFeed :one
+WITH next AS (
+    SELECT f.id, f.last_fetched_at FROM feeds f
+    LEFT JOIN websub_subscriptions w ON w.feed_id = f.id AND w.lease_expires_at > NOW()
+    --feeds a hub pushes to are only left out while we run a callback server to receive them
+    WHERE NOT $1::boolean OR w.id IS NULL
+    ORDER BY f.last_fetched_at ASC NULLS FIRST
+    LIMIT 1
+    --concurrent workers each claim a different feed
+    FOR UPDATE OF f SKIP LOCKED
+)
+UPDATE feeds
+SET last_fetched_at = NOW(),
+    updated_at = NOW()
+FROM next
+WHERE feeds.id = next.id
+RETURNING feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.feed_type, feeds.config, next.last_fetched_at AS previous_fetched_at
+`
+
+type ClaimNextFeedRow struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Name              string
+	Url               string
+	UserID            uuid.UUID
+	LastFetchedAt     sql.NullTime
+	FeedType          string
+	Config            json.RawMessage
+	PreviousFetchedAt sql.NullTime
+}
+
+func (q *Queries) ClaimNextFeed(ctx context.Context, skipPushed bool) (ClaimNextFeedRow, error) {
+	row := q.db.QueryRowContext(ctx, claimNextFeed, skipPushed)
+	var i ClaimNextFeedRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.FeedType,
+		&i.Config,
+		&i.PreviousFetchedAt,
+	)
+	return i, err
+}
+
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds(id, created_at, updated_at, name, url, user_id)
+INSERT INTO feeds(id, created_at, updated_at, name, url, user_id, feed_type, config)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7,
+    $8
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, feed_type, config
 `
 
 type CreateFeedParams struct {
@@ -32,6 +86,8 @@ type CreateFeedParams struct {
 	Name      string
 	Url       string
 	UserID    uuid.UUID
+	FeedType  string
+	Config    json.RawMessage
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -42,6 +98,8 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.Name,
 		arg.Url,
 		arg.UserID,
+		arg.FeedType,
+		arg.Config,
 	)
 	var i Feed
 	err := row.Scan(
@@ -52,12 +110,14 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.FeedType,
+		&i.Config,
 	)
 	return i, err
 }
 
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds WHERE url = $1
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, feed_type, config FROM feeds WHERE url = $1
 `
 
 func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
@@ -71,12 +131,14 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.FeedType,
+		&i.Config,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, feed_type, config FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -96,6 +158,8 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.FeedType,
+			&i.Config,
 		); err != nil {
 			return nil, err
 		}
@@ -110,25 +174,76 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST 
-LIMIT 1
+const getFeedsByName = `-- name: GetFeedsByName :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, feed_type, config FROM feeds WHERE name = $1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+func (q *Queries) GetFeedsByName(ctx context.Context, name string) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsByName, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.FeedType,
+			&i.Config,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPollableFeeds = `-- name: GetPollableFeeds :many
+SELECT f.id, f.created_at, f.last_fetched_at FROM feeds f
+LEFT JOIN websub_subscriptions w ON w.feed_id = f.id AND w.lease_expires_at > NOW()
+WHERE NOT $1::boolean OR w.id IS NULL
+`
+
+type GetPollableFeedsRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	LastFetchedAt sql.NullTime
+}
+
+func (q *Queries) GetPollableFeeds(ctx context.Context, skipPushed bool) ([]GetPollableFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPollableFeeds, skipPushed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPollableFeedsRow
+	for rows.Next() {
+		var i GetPollableFeedsRow
+		if err := rows.Scan(&i.ID, &i.CreatedAt, &i.LastFetchedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :exec
@@ -143,6 +258,22 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const releaseFeed = `-- name: ReleaseFeed :exec
+UPDATE feeds
+SET last_fetched_at = $2
+WHERE id = $1
+`
+
+type ReleaseFeedParams struct {
+	ID            uuid.UUID
+	LastFetchedAt sql.NullTime
+}
+
+func (q *Queries) ReleaseFeed(ctx context.Context, arg ReleaseFeedParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeed, arg.ID, arg.LastFetchedAt)
+	return err
+}
+
 const resetFeeds = `-- name: ResetFeeds :exec
 DELETE FROM feeds
 `
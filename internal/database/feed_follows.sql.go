@@ -70,7 +70,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 	return i, err
 }
 
-const deleteFeedFollow = `-- name: DeleteFeedFollow :exec
+const deleteFeedFollow = `-- name: DeleteFeedFollow :execrows
 
 DELETE FROM feed_follows ff
 USING users u, feeds f
@@ -85,9 +85,12 @@ type DeleteFeedFollowParams struct {
 	Url  string
 }
 
-func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) error {
-	_, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.Name, arg.Url)
-	return err
+func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.Name, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
@@ -98,7 +101,8 @@ SELECT
     ff.user_id,
     u.name AS user_name,
     ff.feed_id,
-    f.name AS feed_name
+    f.name AS feed_name,
+    f.url AS feed_url
 FROM feed_follows ff
 JOIN users u ON ff.user_id = u.id
 JOIN feeds f ON ff.feed_id = f.id
@@ -113,6 +117,7 @@ type GetFeedFollowsForUserRow struct {
 	UserName  string
 	FeedID    uuid.UUID
 	FeedName  string
+	FeedUrl   string
 }
 
 func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeedFollowsForUserRow, error) {
@@ -132,6 +137,7 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 			&i.UserName,
 			&i.FeedID,
 			&i.FeedName,
+			&i.FeedUrl,
 		); err != nil {
 			return nil, err
 		}
@@ -6,6 +6,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,6 +20,8 @@ type Feed struct {
 	Url           string
 	UserID        uuid.UUID
 	LastFetchedAt sql.NullTime
+	FeedType      string
+	Config        json.RawMessage
 }
 
 type FeedFollow struct {
@@ -29,15 +32,50 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedState struct {
+	FeedID    uuid.UUID
+	UpdatedAt time.Time
+	State     string
+}
+
+type FetchAttempt struct {
+	ID            uuid.UUID
+	FeedID        uuid.UUID
+	StartedAt     time.Time
+	DurationMs    int32
+	HttpStatus    sql.NullInt32
+	Bytes         int32
+	ItemsParsed   int32
+	PostsInserted int32
+	Duplicates    int32
+	Error         sql.NullString
+	PostsUpdated  int32
+}
+
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       sql.NullString
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        sql.NullString
+	Url          string
+	Description  sql.NullString
+	PublishedAt  sql.NullTime
+	FeedID       uuid.UUID
+	EnclosureUrl sql.NullString
+	Content      sql.NullString
+	Search       interface{}
+}
+
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+type PostStar struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	StarredAt time.Time
 }
 
 type User struct {
@@ -46,3 +84,15 @@ type User struct {
 	UpdatedAt time.Time
 	Name      string
 }
+
+type WebsubSubscription struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FeedID         uuid.UUID
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	LeaseExpiresAt sql.NullTime
+	RequestedAt    sql.NullTime
+}
@@ -11,90 +11,459 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts(id,created_at,updated_at,title,url,description,published_at,feed_id)
-VALUES(
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6,
-    $7,
-    $8
-)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const getPostsForUser = `-- name: GetPostsForUser :many
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, p.enclosure_url
+FROM posts p
+JOIN feed_follows f ON f.feed_id = p.feed_id
+WHERE f.user_id = $1
+  AND ($2::uuid[] IS NULL OR p.feed_id = ANY($2::uuid[]))
+  AND ($3::timestamp IS NULL OR p.published_at >= $3)
+  AND ($4::timestamp IS NULL OR p.published_at < $4)
+  --case-insensitive substring of the title or description, no LIKE wildcards to escape
+  AND ($5::text IS NULL
+      OR strpos(lower(p.title), lower($5)) > 0
+      OR strpos(lower(p.description), lower($5)) > 0)
+  AND ($6::text IS NULL
+      OR p.title ~* $6
+      OR p.description ~* $6)
+  AND (NOT $7::boolean OR p.enclosure_url IS NOT NULL)
+  AND (NOT $8::boolean OR NOT EXISTS (
+      SELECT 1 FROM post_reads r WHERE r.user_id = f.user_id AND r.post_id = p.id
+  ))
+  AND ($9::uuid IS NULL OR
+      (COALESCE(p.published_at, '-infinity'::timestamp), p.id) <
+      (COALESCE($10::timestamp, '-infinity'::timestamp), $9::uuid))
+ORDER BY COALESCE(p.published_at, '-infinity'::timestamp) DESC, p.id DESC
+LIMIT $12
+OFFSET $11
 `
 
-type CreatePostParams struct {
+type GetPostsForUserParams struct {
+	UserID          uuid.UUID
+	FeedIds         []uuid.UUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	Match           sql.NullString
+	Regex           sql.NullString
+	HasEnclosure    bool
+	Unread          bool
+	CursorID        uuid.NullUUID
+	CursorPublished sql.NullTime
+	Offset          int32
+	Limit           int32
+}
+
+type GetPostsForUserRow struct {
+	ID           uuid.UUID
+	Title        sql.NullString
+	Url          string
+	Description  sql.NullString
+	PublishedAt  sql.NullTime
+	FeedID       uuid.UUID
+	EnclosureUrl sql.NullString
+}
+
+// newest first, past the cursor when there is one. The keyset is (published_at, id) with
+// undated posts as the oldest, written as the expression the browse indexes are built on
+// so an index scan gives the order and starts at the cursor
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser,
+		arg.UserID,
+		pq.Array(arg.FeedIds),
+		arg.Since,
+		arg.Until,
+		arg.Match,
+		arg.Regex,
+		arg.HasEnclosure,
+		arg.Unread,
+		arg.CursorID,
+		arg.CursorPublished,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsForUserRow
+	for rows.Next() {
+		var i GetPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.EnclosureUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForUserAfter = `-- name: GetPostsForUserAfter :many
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, p.enclosure_url
+FROM posts p
+JOIN feed_follows f ON f.feed_id = p.feed_id
+WHERE f.user_id = $1
+  AND ($2::uuid[] IS NULL OR p.feed_id = ANY($2::uuid[]))
+  AND ($3::timestamp IS NULL OR p.published_at >= $3)
+  AND ($4::timestamp IS NULL OR p.published_at < $4)
+  --case-insensitive substring of the title or description, no LIKE wildcards to escape
+  AND ($5::text IS NULL
+      OR strpos(lower(p.title), lower($5)) > 0
+      OR strpos(lower(p.description), lower($5)) > 0)
+  AND ($6::text IS NULL
+      OR p.title ~* $6
+      OR p.description ~* $6)
+  AND (NOT $7::boolean OR p.enclosure_url IS NOT NULL)
+  AND (NOT $8::boolean OR NOT EXISTS (
+      SELECT 1 FROM post_reads r WHERE r.user_id = f.user_id AND r.post_id = p.id
+  ))
+  AND $9::uuid IS NOT NULL
+  AND (COALESCE(p.published_at, '-infinity'::timestamp), p.id) >
+      (COALESCE($10::timestamp, '-infinity'::timestamp), $9::uuid)
+ORDER BY COALESCE(p.published_at, '-infinity'::timestamp), p.id
+LIMIT $12
+OFFSET $11
+`
+
+type GetPostsForUserAfterParams struct {
+	UserID          uuid.UUID
+	FeedIds         []uuid.UUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	Match           sql.NullString
+	Regex           sql.NullString
+	HasEnclosure    bool
+	Unread          bool
+	CursorID        uuid.NullUUID
+	CursorPublished sql.NullTime
+	Offset          int32
+	Limit           int32
+}
+
+type GetPostsForUserAfterRow struct {
+	ID           uuid.UUID
+	Title        sql.NullString
+	Url          string
+	Description  sql.NullString
+	PublishedAt  sql.NullTime
+	FeedID       uuid.UUID
+	EnclosureUrl sql.NullString
+}
+
+// oldest first from the cursor, for the page of newer posts before it. Takes the same
+// arguments as GetPostsForUser, the cursor is required
+func (q *Queries) GetPostsForUserAfter(ctx context.Context, arg GetPostsForUserAfterParams) ([]GetPostsForUserAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUserAfter,
+		arg.UserID,
+		pq.Array(arg.FeedIds),
+		arg.Since,
+		arg.Until,
+		arg.Match,
+		arg.Regex,
+		arg.HasEnclosure,
+		arg.Unread,
+		arg.CursorID,
+		arg.CursorPublished,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsForUserAfterRow
+	for rows.Next() {
+		var i GetPostsForUserAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.EnclosureUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReaderPosts = `-- name: GetReaderPosts :many
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, p.content, f.name AS feed_name,
+    EXISTS (SELECT 1 FROM post_reads r WHERE r.user_id = ff.user_id AND r.post_id = p.id) AS read,
+    EXISTS (SELECT 1 FROM post_stars st WHERE st.user_id = ff.user_id AND st.post_id = p.id) AS starred
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+JOIN feeds f ON f.id = p.feed_id
+WHERE ff.user_id = $1
+  AND ($2::uuid IS NULL OR p.feed_id = $2)
+  AND (NOT $3::boolean OR EXISTS (
+      SELECT 1 FROM post_stars st WHERE st.user_id = ff.user_id AND st.post_id = p.id
+  ))
+ORDER BY p.published_at DESC NULLS LAST, p.id DESC
+LIMIT $4
+`
+
+type GetReaderPostsParams struct {
+	UserID      uuid.UUID
+	FeedID      uuid.NullUUID
+	StarredOnly bool
+	Limit       int32
+}
+
+type GetReaderPostsRow struct {
 	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
 	Title       sql.NullString
 	Url         string
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	Content     sql.NullString
+	FeedName    string
+	Read        bool
+	Starred     bool
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
+// posts without a date go last instead of on top of every list
+func (q *Queries) GetReaderPosts(ctx context.Context, arg GetReaderPostsParams) ([]GetReaderPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getReaderPosts,
+		arg.UserID,
 		arg.FeedID,
+		arg.StarredOnly,
+		arg.Limit,
 	)
-	var i Post
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Url,
-		&i.Description,
-		&i.PublishedAt,
-		&i.FeedID,
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReaderPostsRow
+	for rows.Next() {
+		var i GetReaderPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Content,
+			&i.FeedName,
+			&i.Read,
+			&i.Starred,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertPosts = `-- name: InsertPosts :many
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, enclosure_url, content)
+SELECT
+    t.id,
+    NOW(),
+    NOW(),
+    NULLIF(t.title, ''),
+    t.url,
+    NULLIF(t.description, ''),
+    --items without a date come as the zero time
+    NULLIF(t.published_at, '0001-01-01 00:00:00'::timestamp),
+    $1::uuid,
+    NULLIF(t.enclosure_url, ''),
+    NULLIF(t.content, '')
+FROM (
+    --unnest in the select list walks the arrays side by side
+    SELECT
+        unnest($2::uuid[]) AS id,
+        unnest($3::text[]) AS title,
+        unnest($4::text[]) AS url,
+        unnest($5::text[]) AS description,
+        unnest($6::timestamp[]) AS published_at,
+        unnest($7::text[]) AS enclosure_url,
+        unnest($8::text[]) AS content
+) AS t
+ON CONFLICT (url) DO UPDATE
+SET title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    published_at = EXCLUDED.published_at,
+    enclosure_url = EXCLUDED.enclosure_url,
+    content = EXCLUDED.content,
+    updated_at = NOW()
+WHERE $9::boolean
+  AND posts.feed_id = EXCLUDED.feed_id
+  --an item without a date is never newer, it would update the post on every fetch
+  AND EXCLUDED.published_at IS NOT NULL
+  AND (posts.published_at IS NULL OR posts.published_at < EXCLUDED.published_at)
+RETURNING id
+`
+
+type InsertPostsParams struct {
+	FeedID         uuid.UUID
+	Ids            []uuid.UUID
+	Titles         []string
+	Urls           []string
+	Descriptions   []string
+	PublishedAts   []time.Time
+	EnclosureUrls  []string
+	Contents       []string
+	UpdateExisting bool
+}
+
+// with update_existing (sources that report changes, like sitemaps) posts that come back
+// with a newer date are refreshed and returned too, otherwise known urls are skipped
+func (q *Queries) InsertPosts(ctx context.Context, arg InsertPostsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, insertPosts,
+		arg.FeedID,
+		pq.Array(arg.Ids),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.PublishedAts),
+		pq.Array(arg.EnclosureUrls),
+		pq.Array(arg.Contents),
+		arg.UpdateExisting,
 	)
-	return i, err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT p.id, p.created_at, p.updated_at, p.title, p.url, p.description, p.published_at, p.feed_id FROM posts p
-JOIN feed_follows f ON f.feed_id = p.feed_id
-WHERE f.user_id = $1
-ORDER BY p.published_at DESC
-LIMIT $2
+const notifyPostsInserted = `-- name: NotifyPostsInserted :exec
+SELECT pg_notify('gator_posts', $1::uuid::text)
 `
 
-type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+// delivered to listeners like the reader when the transaction commits
+func (q *Queries) NotifyPostsInserted(ctx context.Context, feedID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, notifyPostsInserted, feedID)
+	return err
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+const resetPosts = `-- name: ResetPosts :exec
+DELETE FROM posts
+`
+
+func (q *Queries) ResetPosts(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, resetPosts)
+	return err
+}
+
+const searchPosts = `-- name: SearchPosts :many
+WITH q AS (
+    SELECT websearch_to_tsquery('english', $6) AS query
+)
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, f.name AS feed_name,
+    ts_rank_cd(p.search, q.query)::real AS rank,
+    ts_headline('english', coalesce(p.title, ''), q.query, $1::text)::text AS title_headline,
+    --tags would end up in the snippet, match on the text between them
+    ts_headline('english', regexp_replace(coalesce(p.content, p.description, ''), '<[^>]*>', ' ', 'g'),
+        q.query, $2::text)::text AS snippet
+FROM posts p
+JOIN feeds f ON f.id = p.feed_id
+CROSS JOIN q
+WHERE p.search @@ q.query
+  AND ($3::boolean OR EXISTS (
+      SELECT 1 FROM feed_follows ff WHERE ff.feed_id = p.feed_id AND ff.user_id = $4
+  ))
+ORDER BY rank DESC, p.published_at DESC NULLS LAST
+LIMIT $5
+`
+
+type SearchPostsParams struct {
+	TitleOptions   string
+	SnippetOptions string
+	All            bool
+	UserID         uuid.UUID
+	Limit          int32
+	Query          string
+}
+
+type SearchPostsRow struct {
+	ID            uuid.UUID
+	Title         sql.NullString
+	Url           string
+	Description   sql.NullString
+	PublishedAt   sql.NullTime
+	FeedID        uuid.UUID
+	FeedName      string
+	Rank          float32
+	TitleHeadline string
+	Snippet       string
+}
+
+// the english configuration the search column and its GIN index are built with
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPosts,
+		arg.TitleOptions,
+		arg.SnippetOptions,
+		arg.All,
+		arg.UserID,
+		arg.Limit,
+		arg.Query,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []SearchPostsRow
 	for rows.Next() {
-		var i Post
+		var i SearchPostsRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
 			&i.Title,
 			&i.Url,
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.FeedName,
+			&i.Rank,
+			&i.TitleHeadline,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -109,11 +478,95 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	return items, nil
 }
 
-const resetPosts = `-- name: ResetPosts :exec
-DELETE FROM posts
+const searchPostsInLanguage = `-- name: SearchPostsInLanguage :many
+WITH q AS (
+    SELECT websearch_to_tsquery($1::text::regconfig, $7) AS query
+)
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, f.name AS feed_name,
+    ts_rank_cd(d.document, q.query)::real AS rank,
+    ts_headline($1::text::regconfig, coalesce(p.title, ''), q.query,
+        $2::text)::text AS title_headline,
+    ts_headline($1::text::regconfig,
+        regexp_replace(coalesce(p.content, p.description, ''), '<[^>]*>', ' ', 'g'),
+        q.query, $3::text)::text AS snippet
+FROM posts p
+JOIN feeds f ON f.id = p.feed_id
+CROSS JOIN q
+CROSS JOIN LATERAL (
+    SELECT setweight(to_tsvector($1::text::regconfig, coalesce(p.title, '')), 'A') ||
+        setweight(to_tsvector($1::text::regconfig, coalesce(p.description, '')), 'B') ||
+        setweight(to_tsvector($1::text::regconfig, coalesce(p.content, '')), 'C') AS document
+) d
+WHERE d.document @@ q.query
+  AND ($4::boolean OR EXISTS (
+      SELECT 1 FROM feed_follows ff WHERE ff.feed_id = p.feed_id AND ff.user_id = $5
+  ))
+ORDER BY rank DESC, p.published_at DESC NULLS LAST
+LIMIT $6
 `
 
-func (q *Queries) ResetPosts(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, resetPosts)
-	return err
+type SearchPostsInLanguageParams struct {
+	Language       string
+	TitleOptions   string
+	SnippetOptions string
+	All            bool
+	UserID         uuid.UUID
+	Limit          int32
+	Query          string
+}
+
+type SearchPostsInLanguageRow struct {
+	ID            uuid.UUID
+	Title         sql.NullString
+	Url           string
+	Description   sql.NullString
+	PublishedAt   sql.NullTime
+	FeedID        uuid.UUID
+	FeedName      string
+	Rank          float32
+	TitleHeadline string
+	Snippet       string
+}
+
+// any other configuration, the vectors are built for every post so it is slower
+func (q *Queries) SearchPostsInLanguage(ctx context.Context, arg SearchPostsInLanguageParams) ([]SearchPostsInLanguageRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsInLanguage,
+		arg.Language,
+		arg.TitleOptions,
+		arg.SnippetOptions,
+		arg.All,
+		arg.UserID,
+		arg.Limit,
+		arg.Query,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsInLanguageRow
+	for rows.Next() {
+		var i SearchPostsInLanguageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.FeedName,
+			&i.Rank,
+			&i.TitleHeadline,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
@@ -0,0 +1,114 @@
+package sources
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strings"
+)
+
+type atomFeed struct {
+	XMLName  xml.Name
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Summary   atomText   `xml:"summary"`
+	Content   atomText   `xml:"content"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+//an Atom text construct: type="text" and type="html" are escaped text, type="xhtml" is
+//markup inside a <div> that has no character data of its own
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+//the content as HTML, or text for type="text"
+func (t atomText) String() string {
+	if t.Type != "xhtml" {
+		return html.UnescapeString(t.Text)
+	}
+	//the <div> only wraps the content and is not part of it
+	inner := strings.TrimSpace(t.Inner)
+	if strings.HasPrefix(inner, "<div") && strings.HasSuffix(inner, "</div>") {
+		if end := strings.Index(inner, ">"); end != -1 {
+			inner = strings.TrimSpace(inner[end+1 : len(inner)-len("</div>")])
+		}
+	}
+	return inner
+}
+
+//atom links without a rel are rel="alternate"
+func atomLinks(links []atomLink) map[string]string {
+	byRel := map[string]string{}
+	for _, link := range links {
+		rel := link.Rel
+		if rel == "" {
+			rel = "alternate"
+		}
+		if _, ok := byRel[rel]; !ok {
+			byRel[rel] = link.Href
+		}
+	}
+	return byRel
+}
+
+func ParseAtom(data []byte) (*Result, error) {
+	var feed atomFeed
+	if err := unmarshalXML(data, &feed); err != nil {
+		return nil, err
+	}
+	//anything else would unmarshal without an error and without entries
+	if feed.XMLName.Local != "feed" {
+		return nil, fmt.Errorf("not an Atom document, the root element is <%v>", feed.XMLName.Local)
+	}
+	links := atomLinks(feed.Links)
+	result := &Result{
+		Format:      TypeAtom,
+		Title:       html.UnescapeString(feed.Title),
+		Link:        links["alternate"],
+		Description: html.UnescapeString(feed.Subtitle),
+		Links:       links,
+	}
+	for _, entry := range feed.Entries {
+		//the content is kept apart only when there is a summary to show instead
+		description, content := entry.Summary.String(), entry.Content.String()
+		if description == "" {
+			description, content = content, ""
+		}
+		published := entry.Published
+		if published == "" {
+			published = entry.Updated
+		}
+		entryLinks := atomLinks(entry.Links)
+		item := Item{
+			ID:           entry.ID,
+			Title:        html.UnescapeString(entry.Title),
+			Link:         entryLinks["alternate"],
+			Description:  description,
+			Content:      content,
+			PublishedRaw: published,
+			EnclosureURL: entryLinks["enclosure"],
+		}
+		item.parseDate()
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package sources
+
+import "testing"
+
+func TestParseAtomTextConstructs(t *testing.T) {
+	tests := []struct {
+		name        string
+		entry       string
+		description string
+		content     string
+	}{
+		{
+			name:        "text",
+			entry:       `<content>Fish &amp; chips</content>`,
+			description: "Fish & chips",
+		},
+		{
+			name:        "escaped html",
+			entry:       `<content type="html">&lt;p&gt;Hello&lt;/p&gt;</content>`,
+			description: "<p>Hello</p>",
+		},
+		{
+			name:        "html in cdata",
+			entry:       `<content type="html"><![CDATA[<p>Hello</p>]]></content>`,
+			description: "<p>Hello</p>",
+		},
+		{
+			name:        "xhtml without its div",
+			entry:       `<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Hello <b>world</b></p></div></content>`,
+			description: "<p>Hello <b>world</b></p>",
+		},
+		{
+			name: "xhtml summary and content",
+			entry: `<summary type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml">Short</div></summary>
+<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Long</p></div></content>`,
+			description: "Short",
+			content:     "<p>Long</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link href="https://example.com/1"/>` + tt.entry + `</entry></feed>`
+			result, err := ParseAtom([]byte(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			item := result.Items[0]
+			if item.Description != tt.description || item.Content != tt.content {
+				t.Errorf("description %q content %q, want %q %q", item.Description, item.Content, tt.description, tt.content)
+			}
+		})
+	}
+}
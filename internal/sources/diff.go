@@ -0,0 +1,81 @@
+package sources
+
+import "strings"
+
+//above this many cells the LCS table gets too big and changed regions are shown whole
+const diffMaxCells = 4_000_000
+
+//a line diff of two texts: removed lines start with "- ", added ones with "+ ",
+//and unchanged stretches between changes are collapsed to "..."
+func diffLines(old, new []string) string {
+	//pages mostly change in one place, skip the common start and end first
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+	old = old[prefix : len(old)-suffix]
+	new = new[prefix : len(new)-suffix]
+
+	var sb strings.Builder
+	if prefix > 0 {
+		sb.WriteString("...\n")
+	}
+	if len(old)*len(new) > diffMaxCells {
+		for _, line := range old {
+			sb.WriteString("- " + line + "\n")
+		}
+		for _, line := range new {
+			sb.WriteString("+ " + line + "\n")
+		}
+	} else {
+		writeLCSDiff(&sb, old, new)
+	}
+	if suffix > 0 {
+		sb.WriteString("...\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+//classic longest common subsequence diff
+func writeLCSDiff(sb *strings.Builder, old, new []string) {
+	//lcs[i][j] is the LCS length of old[i:] and new[j:]
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	//collapse runs of unchanged lines
+	unchanged := false
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i] == new[j]:
+			if !unchanged {
+				sb.WriteString("...\n")
+				unchanged = true
+			}
+			i++
+			j++
+		case i < len(old) && (j == len(new) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("- " + old[i] + "\n")
+			unchanged = false
+			i++
+		default:
+			sb.WriteString("+ " + new[j] + "\n")
+			unchanged = false
+			j++
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"identical", "a\nb", "a\nb", "..."},
+		{"line added at the end", "a\nb", "a\nb\nc", "...\n+ c"},
+		{"line removed at the start", "a\nb\nc", "b\nc", "- a\n..."},
+		{"line changed in the middle", "a\nb\nc", "a\nx\nc", "...\n- b\n+ x\n..."},
+		{"unchanged lines between changes collapse", "a\nb\nc\nd\ne", "x\nb\nc\nd\ny", "- a\n+ x\n...\n- e\n+ y"},
+		{"everything replaced", "a", "b", "- a\n+ b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffLines(strings.Split(tt.old, "\n"), strings.Split(tt.new, "\n"))
+			if got != tt.want {
+				t.Errorf("diffLines(%q, %q) = %q, want %q", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const FilePrefix = "file://"
+
+//feeds generated on this machine, read from a file:// URL in whatever format they are in
+type fileSource struct{}
+
+func (fileSource) Fetch(ctx context.Context, feed Feed) (*Result, error) {
+	path := strings.TrimPrefix(feed.URL, FilePrefix)
+	meta := FetchMeta{URL: feed.URL}
+	start := time.Now()
+	data, err := os.ReadFile(path)
+	meta.Duration = time.Since(start)
+	meta.Bytes = len(data)
+	if err != nil {
+		return &Result{Meta: meta}, fmt.Errorf("failed to read feed file: %w", err)
+	}
+	result, err := Parse(data)
+	if err != nil {
+		return &Result{Meta: meta}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	result.Meta = meta
+	return result, nil
+}
@@ -0,0 +1,236 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+//pages without a feed, turned into items with CSS selectors from feeds.config
+type htmlSource struct{}
+
+type htmlConfig struct {
+	//matches one element per item, the other selectors are relative to it
+	Item    string `json:"item"`
+	Title   string `json:"title"`
+	Link    string `json:"link"`
+	Date    string `json:"date"`
+	Summary string `json:"summary"`
+	//Go layout for dates ParseDate does not know, e.g. "January 2, 2006"
+	DateFormat string `json:"date_format"`
+}
+
+type htmlSelectors struct {
+	item, title, link, date, summary cascadia.Sel
+}
+
+func parseHTMLConfig(config json.RawMessage) (htmlConfig, htmlSelectors, error) {
+	var cfg htmlConfig
+	var sels htmlSelectors
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return cfg, sels, fmt.Errorf("invalid html feed config: %w", err)
+		}
+	}
+	if cfg.Item == "" || cfg.Title == "" {
+		return cfg, sels, fmt.Errorf("html feeds need at least the item and title selectors")
+	}
+	//optional selectors stay nil
+	for _, field := range []struct {
+		name     string
+		selector string
+		sel      *cascadia.Sel
+	}{
+		{"item", cfg.Item, &sels.item},
+		{"title", cfg.Title, &sels.title},
+		{"link", cfg.Link, &sels.link},
+		{"date", cfg.Date, &sels.date},
+		{"summary", cfg.Summary, &sels.summary},
+	} {
+		if field.selector == "" {
+			continue
+		}
+		sel, err := cascadia.Parse(field.selector)
+		if err != nil {
+			return cfg, sels, fmt.Errorf("invalid %s selector %q: %w", field.name, field.selector, err)
+		}
+		*field.sel = sel
+	}
+	return cfg, sels, nil
+}
+
+func (htmlSource) ValidateConfig(config json.RawMessage) error {
+	_, _, err := parseHTMLConfig(config)
+	return err
+}
+
+func (htmlSource) Fetch(ctx context.Context, feed Feed) (*Result, error) {
+	cfg, sels, err := parseHTMLConfig(feed.Config)
+	if err != nil {
+		return nil, err
+	}
+	data, meta, err := FetchURL(ctx, feed.URL)
+	if err != nil {
+		return &Result{Meta: meta}, err
+	}
+	result, err := scrapeHTML(data, meta.Header.Get("Content-Type"), feed.URL, cfg, sels)
+	if err != nil {
+		return &Result{Meta: meta}, err
+	}
+	result.Meta = meta
+	return result, nil
+}
+
+//parse a page as UTF-8, decoding the charset named by the Content-Type header or a <meta> tag.
+//Text in any other encoding would end up in posts as invalid UTF-8, which Postgres rejects
+func parseHTML(data []byte, contentType string) (*html.Node, error) {
+	body, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode HTML: %w", err)
+	}
+	doc, err := html.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	return doc, nil
+}
+
+func scrapeHTML(data []byte, contentType, pageURL string, cfg htmlConfig, sels htmlSelectors) (*Result, error) {
+	doc, err := parseHTML(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{
+		Format: TypeHTML,
+		Link:   pageURL,
+		Links:  map[string]string{},
+	}
+	if title := cascadia.Query(doc, cascadia.MustCompile("title")); title != nil {
+		result.Title = nodeText(title)
+	}
+
+	for _, node := range cascadia.QueryAll(doc, sels.item) {
+		item := Item{Title: selectText(node, sels.title)}
+		if item.Title == "" {
+			continue
+		}
+		if sels.summary != nil {
+			item.Description = selectText(node, sels.summary)
+		}
+		if sels.date != nil {
+			if dateNode := cascadia.Query(node, sels.date); dateNode != nil {
+				//<time datetime="..."> is more reliable than whatever text it shows
+				item.PublishedRaw = attr(dateNode, "datetime")
+				if item.PublishedRaw == "" {
+					item.PublishedRaw = nodeText(dateNode)
+				}
+				item.Published = parseHTMLDate(item.PublishedRaw, cfg.DateFormat)
+			}
+		}
+		item.Link = itemLink(node, sels.link, base)
+		if item.Link == "" {
+			//posts need a unique URL, point into the page instead
+			fragment := attr(node, "id")
+			if fragment == "" {
+				sum := sha1.Sum([]byte(item.Title))
+				fragment = "item-" + hex.EncodeToString(sum[:6])
+			}
+			link := *base
+			link.Fragment = fragment
+			item.Link = link.String()
+		}
+		item.ID = item.Link
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
+
+func parseHTMLDate(raw, layout string) time.Time {
+	if layout != "" {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t
+		}
+	}
+	if t, err := ParseDate(raw); err == nil {
+		return t
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+//the href of the link selector, or of the first link in the item if there is none
+func itemLink(node *html.Node, sel cascadia.Sel, base *url.URL) string {
+	var linkNode *html.Node
+	switch {
+	case sel != nil:
+		linkNode = cascadia.Query(node, sel)
+	case node.Data == "a":
+		linkNode = node
+	default:
+		linkNode = cascadia.Query(node, cascadia.MustCompile("a[href]"))
+	}
+	if linkNode == nil {
+		return ""
+	}
+	href := attr(linkNode, "href")
+	if href == "" {
+		return ""
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func selectText(node *html.Node, sel cascadia.Sel) string {
+	if found := cascadia.Query(node, sel); found != nil {
+		return nodeText(found)
+	}
+	return ""
+}
+
+func attr(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+//the text content of a node with whitespace collapsed
+func nodeText(node *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style"):
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
@@ -0,0 +1,86 @@
+package sources
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestScrapeHTML(t *testing.T) {
+	list := `<html><head><title>News</title></head><body>
+<article id="first"><h2>First</h2><a href="/posts/1">read</a><time datetime="2024-05-01T12:00:00Z">May 1</time><p>One</p></article>
+<article><h2>Second</h2><span class="date">May 2, 2024</span></article>
+<article><h2></h2><a href="/posts/3">untitled</a></article>
+</body></html>`
+	tests := []struct {
+		name        string
+		doc         string
+		contentType string
+		config      string
+		titles      []string
+		links       []string
+		dates       []time.Time
+	}{
+		{
+			name:   "links are resolved and the datetime attribute wins",
+			doc:    list,
+			config: `{"item":"article","title":"h2","date":"time","summary":"p"}`,
+			titles: []string{"First", "Second"},
+			links:  []string{"https://example.com/posts/1", "https://example.com/news#item-2a4bcae654f2"},
+			dates:  []time.Time{time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), {}},
+		},
+		{
+			name:   "date format for dates ParseDate does not know",
+			doc:    list,
+			config: `{"item":"article","title":"h2","date":".date","date_format":"January 2, 2006"}`,
+			titles: []string{"First", "Second"},
+			links:  []string{"https://example.com/posts/1", "https://example.com/news#item-2a4bcae654f2"},
+			dates:  []time.Time{{}, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "items without a link point at their id",
+			doc:    `<ul><li id="a"><span>Alpha</span></li><li id="b"><span>Beta</span></li></ul>`,
+			config: `{"item":"li","title":"span"}`,
+			titles: []string{"Alpha", "Beta"},
+			links:  []string{"https://example.com/news#a", "https://example.com/news#b"},
+			dates:  []time.Time{{}, {}},
+		},
+		{
+			name:        "latin-1 from the Content-Type header",
+			doc:         "<ul><li id=\"a\"><span>Caf\xe9</span></li></ul>",
+			contentType: "text/html; charset=iso-8859-1",
+			config:      `{"item":"li","title":"span"}`,
+			titles:      []string{"Café"},
+			links:       []string{"https://example.com/news#a"},
+			dates:       []time.Time{{}},
+		},
+		{
+			name:   "windows-1252 from a meta tag",
+			doc:    "<html><head><meta charset=\"windows-1252\"></head><body><ul><li id=\"a\"><span>\x93Quoted\x94</span></li></ul></body></html>",
+			config: `{"item":"li","title":"span"}`,
+			titles: []string{"“Quoted”"},
+			links:  []string{"https://example.com/news#a"},
+			dates:  []time.Time{{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, sels, err := parseHTMLConfig(json.RawMessage(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := scrapeHTML([]byte(tt.doc), tt.contentType, "https://example.com/news", cfg, sels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Items) != len(tt.titles) {
+				t.Fatalf("got %v items, want %v: %+v", len(result.Items), len(tt.titles), result.Items)
+			}
+			for i, item := range result.Items {
+				if item.Title != tt.titles[i] || item.Link != tt.links[i] || !item.Published.Equal(tt.dates[i]) {
+					t.Errorf("item %v = %q %q %v, want %q %q %v", i, item.Title, item.Link, item.Published, tt.titles[i], tt.links[i], tt.dates[i])
+				}
+			}
+		})
+	}
+}
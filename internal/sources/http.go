@@ -0,0 +1,95 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var client = &http.Client{}
+
+//the built-in sources that GET a URL and parse the body in a fixed format
+type httpSource struct {
+	parse func([]byte) (*Result, error)
+}
+
+func (h httpSource) Fetch(ctx context.Context, feed Feed) (*Result, error) {
+	data, meta, err := FetchURL(ctx, feed.URL)
+	if err != nil {
+		return &Result{Meta: meta}, err
+	}
+	result, err := h.parse(data)
+	if err != nil {
+		return &Result{Meta: meta}, fmt.Errorf("failed to parse %s: %w (content preview: %.200s...)", feed.URL, err, string(data))
+	}
+	result.Meta = meta
+	//publishers may also advertise their hub in the Link header instead of the document
+	for rel, href := range ParseLinkHeader(meta.Header.Values("Link")) {
+		if _, ok := result.Links[rel]; !ok {
+			result.Links[rel] = href
+		}
+	}
+	return result, nil
+}
+
+//GET a URL and return its body, for sources that fetch over HTTP
+func FetchURL(ctx context.Context, url string) ([]byte, FetchMeta, error) {
+	meta := FetchMeta{URL: url}
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, meta, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("User-Agent", "gator")
+	resp, err := client.Do(req)
+	if err != nil {
+		meta.Duration = time.Since(start)
+		return nil, meta, fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	meta.StatusCode = resp.StatusCode
+	meta.Header = resp.Header
+
+	data, err := io.ReadAll(resp.Body)
+	meta.Bytes = len(data)
+	meta.Duration = time.Since(start)
+	if err != nil {
+		return nil, meta, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, meta, fmt.Errorf("unexpected HTTP status %v", resp.Status)
+	}
+	return data, meta, nil
+}
+
+//parse Link headers like `<https://hub.example.com/>; rel="hub"` into rel->href
+func ParseLinkHeader(headers []string) map[string]string {
+	links := map[string]string{}
+	for _, header := range headers {
+		for _, part := range strings.Split(header, ",") {
+			target, params, ok := strings.Cut(part, ";")
+			if !ok {
+				continue
+			}
+			target = strings.TrimSpace(target)
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range strings.Split(params, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(key, "rel") {
+					for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+						if _, seen := links[rel]; !seen {
+							links[rel] = target[1 : len(target)-1]
+						}
+					}
+				}
+			}
+		}
+	}
+	return links
+}
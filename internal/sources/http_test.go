@@ -0,0 +1,35 @@
+package sources
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    map[string]string
+	}{
+		{"none", nil, map[string]string{}},
+		{"hub and self", []string{`<https://hub.example.com/>; rel="hub", <https://example.com/feed>; rel="self"`},
+			map[string]string{"hub": "https://hub.example.com/", "self": "https://example.com/feed"}},
+		{"several headers", []string{`<https://hub.example.com/>; rel=hub`, `<https://example.com/feed>; rel=self`},
+			map[string]string{"hub": "https://hub.example.com/", "self": "https://example.com/feed"}},
+		{"several rels in one link", []string{`<https://example.com/feed>; rel="self alternate"`},
+			map[string]string{"self": "https://example.com/feed", "alternate": "https://example.com/feed"}},
+		{"first link of a rel wins", []string{`<https://a.example.com/>; rel="hub", <https://b.example.com/>; rel="hub"`},
+			map[string]string{"hub": "https://a.example.com/"}},
+		{"rel in any case, after other params", []string{`<https://hub.example.com/>; title="Hub"; REL="hub"`},
+			map[string]string{"hub": "https://hub.example.com/"}},
+		{"target without brackets", []string{`https://hub.example.com/; rel="hub"`}, map[string]string{}},
+		{"no params", []string{`<https://hub.example.com/>`}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseLinkHeader(tt.headers); !maps.Equal(got, tt.want) {
+				t.Errorf("ParseLinkHeader(%q) = %v, want %v", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
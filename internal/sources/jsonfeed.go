@@ -0,0 +1,92 @@
+package sources
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//https://www.jsonfeed.org/version/1.1/
+type jsonFeed struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	FeedURL     string `json:"feed_url"`
+	Description string `json:"description"`
+	Hubs        []struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	} `json:"hubs"`
+	Items []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            json.RawMessage `json:"id"`
+	URL           string          `json:"url"`
+	ExternalURL   string          `json:"external_url"`
+	Title         string          `json:"title"`
+	Summary       string          `json:"summary"`
+	ContentHTML   string          `json:"content_html"`
+	ContentText   string          `json:"content_text"`
+	DatePublished string          `json:"date_published"`
+	DateModified  string          `json:"date_modified"`
+	Attachments   []struct {
+		URL string `json:"url"`
+	} `json:"attachments"`
+}
+
+func ParseJSONFeed(data []byte) (*Result, error) {
+	var feed jsonFeed
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+	result := &Result{
+		Format:      TypeJSONFeed,
+		Title:       feed.Title,
+		Link:        feed.HomePageURL,
+		Description: feed.Description,
+		Links:       map[string]string{},
+	}
+	if feed.FeedURL != "" {
+		result.Links["self"] = feed.FeedURL
+	}
+	for _, hub := range feed.Hubs {
+		if strings.EqualFold(hub.Type, "WebSub") {
+			result.Links["hub"] = hub.URL
+			break
+		}
+	}
+	for _, feedItem := range feed.Items {
+		link := feedItem.URL
+		if link == "" {
+			link = feedItem.ExternalURL
+		}
+		content := feedItem.ContentHTML
+		if content == "" {
+			content = feedItem.ContentText
+		}
+		//the content is kept apart only when there is a summary to show instead
+		description := feedItem.Summary
+		if description == "" {
+			description, content = content, ""
+		}
+		published := feedItem.DatePublished
+		if published == "" {
+			published = feedItem.DateModified
+		}
+		item := Item{
+			//ids are strings in 1.1 but were allowed to be numbers in 1.0
+			ID:           strings.Trim(string(feedItem.ID), `"`),
+			Title:        feedItem.Title,
+			Link:         link,
+			Description:  description,
+			Content:      content,
+			PublishedRaw: published,
+		}
+		if len(feedItem.Attachments) > 0 {
+			item.EnclosureURL = feedItem.Attachments[0].URL
+		}
+		item.parseDate()
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
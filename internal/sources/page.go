@@ -0,0 +1,171 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+//descriptions longer than this are cut, the post links to the page anyway
+const pageMaxDiff = 4000
+
+//starts every saved snapshot, so a page whose text is empty still counts as seen
+const pageSnapshotMarker = "snapshot\n"
+
+//any page as a feed: the text of the page is kept as the feed state and
+//every fetch that changes it produces a post with the diff as description
+type pageSource struct{}
+
+type pageConfig struct {
+	//only watch the part of the page matching this CSS selector
+	Selector string `json:"selector"`
+	//drop lines matching this regular expression, e.g. timestamps that change on every load
+	Ignore string `json:"ignore"`
+}
+
+func parsePageConfig(config json.RawMessage) (cascadia.Sel, *regexp.Regexp, error) {
+	var cfg pageConfig
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, nil, fmt.Errorf("invalid page feed config: %w", err)
+		}
+	}
+	var sel cascadia.Sel
+	var ignore *regexp.Regexp
+	var err error
+	if cfg.Selector != "" {
+		if sel, err = cascadia.Parse(cfg.Selector); err != nil {
+			return nil, nil, fmt.Errorf("invalid selector %q: %w", cfg.Selector, err)
+		}
+	}
+	if cfg.Ignore != "" {
+		if ignore, err = regexp.Compile(cfg.Ignore); err != nil {
+			return nil, nil, fmt.Errorf("invalid ignore regex %q: %w", cfg.Ignore, err)
+		}
+	}
+	return sel, ignore, nil
+}
+
+func (pageSource) ValidateConfig(config json.RawMessage) error {
+	_, _, err := parsePageConfig(config)
+	return err
+}
+
+func (pageSource) Fetch(ctx context.Context, feed Feed) (*Result, error) {
+	sel, ignore, err := parsePageConfig(feed.Config)
+	if err != nil {
+		return nil, err
+	}
+	data, meta, err := FetchURL(ctx, feed.URL)
+	if err != nil {
+		return &Result{Meta: meta}, err
+	}
+	doc, err := parseHTML(data, meta.Header.Get("Content-Type"))
+	if err != nil {
+		return &Result{Meta: meta}, err
+	}
+	result := &Result{
+		Format: TypePage,
+		Title:  feed.URL,
+		Link:   feed.URL,
+		Links:  map[string]string{},
+		Meta:   meta,
+	}
+	if title := cascadia.Query(doc, cascadia.MustCompile("title")); title != nil {
+		result.Title = nodeText(title)
+	}
+	root := doc
+	if sel != nil {
+		if root = cascadia.Query(doc, sel); root == nil {
+			return result, fmt.Errorf("selector matched nothing on %s", feed.URL)
+		}
+	}
+	text := pageText(root, ignore)
+	state := pageSnapshotMarker + text
+	result.State = &state
+
+	//the first fetch only takes the snapshot
+	previous, seen := strings.CutPrefix(feed.State, pageSnapshotMarker)
+	if !seen || previous == text {
+		return result, nil
+	}
+	now := time.Now().UTC()
+	diff := diffLines(pageLines(previous), pageLines(text))
+	if len(diff) > pageMaxDiff {
+		//back up to the start of a rune so the cut never splits a character
+		cut := pageMaxDiff
+		for cut > 0 && !utf8.RuneStart(diff[cut]) {
+			cut--
+		}
+		diff = diff[:cut] + "\n..."
+	}
+	result.Items = append(result.Items, Item{
+		//posts need unique URLs, every change gets its own fragment
+		ID:           feed.URL + "#changed-" + now.Format("20060102T150405Z"),
+		Link:         feed.URL + "#changed-" + now.Format("20060102T150405Z"),
+		Title:        result.Title + " changed",
+		Description:  diff,
+		PublishedRaw: now.Format(time.RFC3339),
+		Published:    now,
+	})
+	return result, nil
+}
+
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+//the visible text of a node, one line per block element, so diffs read naturally
+func pageText(node *html.Node, ignore *regexp.Regexp) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style" || n.Data == "noscript" || n.Data == "head"):
+			return
+		}
+		block := n.Type == html.ElementNode && blockElements[n.Data]
+		if block {
+			sb.WriteString("\n")
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			sb.WriteString("\n")
+		}
+	}
+	walk(node)
+
+	var lines []string
+	for _, line := range strings.Split(sb.String(), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" || (ignore != nil && ignore.MatchString(line)) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+//the lines of a snapshot, none for an empty one
+func pageLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
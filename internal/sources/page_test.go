@@ -0,0 +1,50 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPageFetch(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(body))
+	}))
+	defer server.Close()
+	page := func(main string) string {
+		return "<html><head><title>Pricing</title></head><body><main>" + main + "</main><footer>footer</footer></body></html>"
+	}
+	config := []byte(`{"selector":"main"}`)
+
+	//each step fetches the page with the state the previous one saved
+	steps := []struct {
+		name string
+		body string
+		diff string
+	}{
+		{"first fetch only takes the snapshot", page("<p>Basic 5</p>"), ""},
+		{"unchanged", page("<p>Basic 5</p>"), ""},
+		{"changed", page("<p>Basic 6</p>"), "- Basic 5\n+ Basic 6"},
+		{"emptied", page(""), "- Basic 6"},
+		{"still empty", page(""), ""},
+		{"filled again after being empty", page("<p>Pro 9</p>"), "+ Pro 9"},
+	}
+	state := ""
+	for _, step := range steps {
+		body = step.body
+		result, err := pageSource{}.Fetch(context.Background(), Feed{URL: server.URL, Config: config, State: state})
+		if err != nil {
+			t.Fatalf("%v: %v", step.name, err)
+		}
+		diff := ""
+		if len(result.Items) > 0 {
+			diff = result.Items[0].Description
+		}
+		if len(result.Items) > 1 || diff != step.diff {
+			t.Errorf("%v: got %v items, diff %q, want %q", step.name, len(result.Items), diff, step.diff)
+		}
+		state = *result.State
+	}
+}
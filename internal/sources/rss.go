@@ -0,0 +1,78 @@
+package sources
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+)
+
+//RSS 2.0 (<rss>) and RSS 1.0 (<rdf:RDF>), which keeps its items next to the channel instead of inside it
+type rssFeed struct {
+	XMLName xml.Name
+	Channel struct {
+		Title string `xml:"title"`
+		//atom:link elements, used by WebSub publishers to advertise their hub.
+		//Must come before Link, otherwise Link would also swallow them
+		AtomLinks   []atomLink `xml:"http://www.w3.org/2005/Atom link"`
+		Link        string     `xml:"link"`
+		Description string     `xml:"description"`
+		Item        []rssItem  `xml:"item"`
+	} `xml:"channel"`
+	RDFItems []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        string `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string `xml:"pubDate"`
+	//RSS 1.0 dates items with Dublin Core
+	DCDate    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Enclosure struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+}
+
+func ParseRSS(data []byte) (*Result, error) {
+	var feed rssFeed
+	if err := unmarshalXML(data, &feed); err != nil {
+		return nil, err
+	}
+	//anything else would unmarshal without an error and without items
+	if feed.XMLName.Local != "rss" && feed.XMLName.Local != "RDF" {
+		return nil, fmt.Errorf("not an RSS document, the root element is <%v>", feed.XMLName.Local)
+	}
+	//Unescape strings
+	result := &Result{
+		Format:      TypeRSS,
+		Title:       html.UnescapeString(feed.Channel.Title),
+		Link:        feed.Channel.Link,
+		Description: html.UnescapeString(feed.Channel.Description),
+		Links:       map[string]string{},
+	}
+	for _, link := range feed.Channel.AtomLinks {
+		if _, ok := result.Links[link.Rel]; !ok {
+			result.Links[link.Rel] = link.Href
+		}
+	}
+	for _, rssItem := range append(feed.Channel.Item, feed.RDFItems...) {
+		published := rssItem.PubDate
+		if published == "" {
+			published = rssItem.DCDate
+		}
+		item := Item{
+			ID:           rssItem.GUID,
+			Title:        html.UnescapeString(rssItem.Title),
+			Link:         rssItem.Link,
+			Description:  html.UnescapeString(rssItem.Description),
+			Content:      rssItem.Content,
+			PublishedRaw: published,
+			EnclosureURL: rssItem.Enclosure.URL,
+		}
+		item.parseDate()
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
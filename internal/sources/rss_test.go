@@ -0,0 +1,85 @@
+package sources
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseRSS(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		links   []string
+		dates   []string
+		wantErr bool
+	}{
+		{
+			name: "rss 2.0",
+			doc: `<rss version="2.0"><channel><title>Blog</title>
+<item><title>One</title><link>https://example.com/1</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+<item><title>Two</title><link>https://example.com/2</link></item>
+</channel></rss>`,
+			links: []string{"https://example.com/1", "https://example.com/2"},
+			dates: []string{"Mon, 02 Jan 2006 15:04:05 GMT", ""},
+		},
+		{
+			name: "rss 1.0 keeps items next to the channel",
+			doc: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>Blog</title></channel>
+<item><title>One</title><link>https://example.com/1</link><dc:date>2006-01-02T15:04:05Z</dc:date></item>
+<item><title>Two</title><link>https://example.com/2</link></item>
+</rdf:RDF>`,
+			links: []string{"https://example.com/1", "https://example.com/2"},
+			dates: []string{"2006-01-02T15:04:05Z", ""},
+		},
+		{
+			name:    "atom is not rss",
+			doc:     `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link href="https://example.com/1"/></entry></feed>`,
+			wantErr: true,
+		},
+		{
+			name: "encoding from the xml declaration",
+			doc: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss version=\"2.0\"><channel><title>Caf\xe9</title>" +
+				"<item><title>Caf\xe9</title><link>https://example.com/caf\xe9</link></item></channel></rss>",
+			links: []string{"https://example.com/café"},
+			dates: []string{""},
+		},
+		{
+			name:    "html is not rss",
+			doc:     `<html><body></body></html>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseRSS([]byte(tt.doc))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRSS succeeded with %v items, want an error", len(result.Items))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var links, dates []string
+			for _, item := range result.Items {
+				links = append(links, item.Link)
+				dates = append(dates, item.PublishedRaw)
+			}
+			if !slices.Equal(links, tt.links) || !slices.Equal(dates, tt.dates) {
+				t.Errorf("got links %q dates %q, want %q %q", links, dates, tt.links, tt.dates)
+			}
+		})
+	}
+}
+
+func TestParseAtomRejectsOtherDocuments(t *testing.T) {
+	if _, err := ParseAtom([]byte(`<rss version="2.0"><channel></channel></rss>`)); err == nil {
+		t.Error("ParseAtom accepted an RSS document")
+	}
+	result, err := ParseAtom([]byte(`<feed xmlns="http://www.w3.org/2005/Atom"><entry><link href="https://example.com/1"/></entry></feed>`))
+	if err != nil || len(result.Items) != 1 || result.Items[0].Link != "https://example.com/1" {
+		t.Errorf("ParseAtom = %+v, %v", result, err)
+	}
+}
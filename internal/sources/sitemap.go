@@ -0,0 +1,187 @@
+package sources
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	//nested indexes are not allowed by the protocol, one level of sitemaps below the index is enough
+	sitemapMaxDepth = 1
+	//cap on child sitemaps fetched per index
+	sitemapMaxChildren = 50
+	//the protocol's limit on an uncompressed sitemap, a small .xml.gz could inflate far beyond it
+	sitemapMaxSize = 50 << 20
+)
+
+//sitemap.xml files and sitemap indexes, every listed URL becomes a post and
+//a newer <lastmod> updates it and marks it unread, so doc changes show up in browse
+type sitemapSource struct{}
+
+type sitemapConfig struct {
+	//only URLs whose path starts with this
+	Prefix string `json:"prefix"`
+	//only URLs matching this regular expression
+	Regex string `json:"regex"`
+}
+
+//<urlset> and <sitemapindex> share the shape we need
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+func parseSitemapConfig(config json.RawMessage) (sitemapConfig, *regexp.Regexp, error) {
+	var cfg sitemapConfig
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return cfg, nil, fmt.Errorf("invalid sitemap feed config: %w", err)
+		}
+	}
+	if cfg.Regex == "" {
+		return cfg, nil, nil
+	}
+	re, err := regexp.Compile(cfg.Regex)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("invalid regex %q: %w", cfg.Regex, err)
+	}
+	return cfg, re, nil
+}
+
+func (sitemapSource) ValidateConfig(config json.RawMessage) error {
+	_, _, err := parseSitemapConfig(config)
+	return err
+}
+
+func (sitemapSource) Fetch(ctx context.Context, feed Feed) (*Result, error) {
+	cfg, re, err := parseSitemapConfig(feed.Config)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{
+		Format:       TypeSitemap,
+		Title:        feed.URL,
+		Link:         feed.URL,
+		Links:        map[string]string{},
+		UpdatesPosts: true,
+	}
+	entries, err := fetchSitemap(ctx, feed.URL, 0, &result.Meta)
+	if err != nil {
+		return result, err
+	}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" || seen[loc] {
+			continue
+		}
+		seen[loc] = true
+		u, err := url.Parse(loc)
+		if err != nil {
+			continue
+		}
+		if cfg.Prefix != "" && !strings.HasPrefix(u.Path, cfg.Prefix) {
+			continue
+		}
+		if re != nil && !re.MatchString(loc) {
+			continue
+		}
+		title := u.Path
+		if title == "" || title == "/" {
+			title = u.Host
+		}
+		result.Items = append(result.Items, Item{
+			ID:           loc,
+			Title:        title,
+			Link:         loc,
+			PublishedRaw: strings.TrimSpace(entry.LastMod),
+			Published:    parseW3CDate(strings.TrimSpace(entry.LastMod)),
+		})
+	}
+	return result, nil
+}
+
+//fetch a sitemap and return its URLs, following an index down to its sitemaps.
+//meta describes the first request, with the bytes of all of them
+func fetchSitemap(ctx context.Context, sitemapURL string, depth int, meta *FetchMeta) ([]sitemapEntry, error) {
+	data, fetchMeta, err := FetchURL(ctx, sitemapURL)
+	if depth == 0 {
+		*meta = fetchMeta
+	} else {
+		meta.Bytes += fetchMeta.Bytes
+	}
+	if err != nil {
+		return nil, err
+	}
+	//sitemaps are often served as .xml.gz
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", sitemapURL, err)
+		}
+		data, err = io.ReadAll(io.LimitReader(reader, sitemapMaxSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", sitemapURL, err)
+		}
+		if len(data) > sitemapMaxSize {
+			return nil, fmt.Errorf("sitemap %s is larger than %v MB uncompressed", sitemapURL, sitemapMaxSize>>20)
+		}
+	}
+	var doc sitemapDocument
+	if err := unmarshalXML(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+	switch doc.XMLName.Local {
+	case "urlset":
+		return doc.URLs, nil
+	case "sitemapindex":
+		if depth >= sitemapMaxDepth {
+			return nil, fmt.Errorf("sitemap index %s is nested too deep", sitemapURL)
+		}
+		var entries []sitemapEntry
+		var failed []error
+		children := doc.Sitemaps[:min(len(doc.Sitemaps), sitemapMaxChildren)]
+		for _, child := range children {
+			childEntries, err := fetchSitemap(ctx, strings.TrimSpace(child.Loc), depth+1, meta)
+			if err != nil {
+				//one broken sitemap should not hide the others
+				slog.Warn("Skipping sitemap", "index", sitemapURL, "sitemap", child.Loc, "err", err)
+				failed = append(failed, err)
+				continue
+			}
+			entries = append(entries, childEntries...)
+		}
+		if len(children) > 0 && len(failed) == len(children) {
+			return nil, fmt.Errorf("every sitemap of index %s failed: %w", sitemapURL, errors.Join(failed...))
+		}
+		return entries, nil
+	}
+	return nil, fmt.Errorf("%s is not a sitemap, root element is <%s>", sitemapURL, doc.XMLName.Local)
+}
+
+//<lastmod> uses W3C datetime, which allows dropping the seconds or the whole time
+func parseW3CDate(value string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,84 @@
+package sources
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSitemapFetch(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(`<urlset><url><loc>https://example.com/docs/a</loc><lastmod>2024-05-01</lastmod></url></urlset>`))
+	zw.Close()
+	var bomb bytes.Buffer
+	zw = gzip.NewWriter(&bomb)
+	zw.Write([]byte("<urlset>"))
+	zw.Write(bytes.Repeat([]byte(" "), sitemapMaxSize))
+	zw.Close()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	index := func(children ...string) string {
+		var sb strings.Builder
+		sb.WriteString("<sitemapindex>")
+		for _, child := range children {
+			sb.WriteString("<sitemap><loc>" + server.URL + child + "</loc></sitemap>")
+		}
+		sb.WriteString("</sitemapindex>")
+		return sb.String()
+	}
+	pages := map[string]string{
+		"/plain.xml":   `<urlset><url><loc>https://example.com/docs/b</loc></url><url><loc>https://example.com/blog/c</loc></url></urlset>`,
+		"/docs.xml.gz": gzipped.String(),
+		"/bomb.xml.gz": bomb.String(),
+		"/index.xml":   index("/plain.xml", "/missing.xml", "/docs.xml.gz"),
+		"/broken.xml":  index("/missing.xml", "/bomb.xml.gz"),
+		"/empty.xml":   index(),
+	}
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Write([]byte(page))
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		config  string
+		links   []string
+		wantErr bool
+	}{
+		{"urlset", "/plain.xml", "", []string{"https://example.com/docs/b", "https://example.com/blog/c"}, false},
+		{"prefix", "/plain.xml", `{"prefix":"/docs"}`, []string{"https://example.com/docs/b"}, false},
+		{"gzipped", "/docs.xml.gz", "", []string{"https://example.com/docs/a"}, false},
+		{"index skips a broken sitemap", "/index.xml", "", []string{"https://example.com/docs/b", "https://example.com/blog/c", "https://example.com/docs/a"}, false},
+		{"index with every sitemap broken", "/broken.xml", "", nil, true},
+		{"empty index", "/empty.xml", "", nil, false},
+		{"decompresses to more than the limit", "/bomb.xml.gz", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := sitemapSource{}.Fetch(context.Background(), Feed{URL: server.URL + tt.path, Config: []byte(tt.config)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var links []string
+			for _, item := range result.Items {
+				links = append(links, item.Link)
+			}
+			if !slices.Equal(links, tt.links) {
+				t.Errorf("got %q, want %q", links, tt.links)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+//A Source knows how to fetch one type of feed and turn it into normalized items.
+//New feed types only need to implement it and call Register, the scheduler dispatches on feeds.feed_type.
+type Source interface {
+	//On failure the result may still be non-nil and carry the metadata gathered so far
+	Fetch(ctx context.Context, feed Feed) (*Result, error)
+}
+
+//Sources that need settings beyond the URL (feeds.config) implement this, addfeed calls it before saving the feed
+type ConfigValidator interface {
+	ValidateConfig(config json.RawMessage) error
+}
+
+//the parts of a feeds row a source needs
+type Feed struct {
+	URL    string
+	Type   string
+	Config json.RawMessage
+	//whatever the source returned as Result.State on the previous fetch
+	State string
+}
+
+//a fetched feed, independent of the format it came in
+type Result struct {
+	Format      string
+	Title       string
+	Link        string
+	Description string
+	Items       []Item
+	//rel -> href for links advertised by the feed, e.g. "hub" and "self" for WebSub
+	Links map[string]string
+	//items that come back with a newer date replace the stored post instead of being skipped
+	UpdatesPosts bool
+	//if set, stored for the feed and handed back as Feed.State next time
+	State *string
+	Meta  FetchMeta
+}
+
+//a single entry, which becomes a row in posts
+type Item struct {
+	ID          string
+	Title       string
+	Link        string
+	Description string
+	//the full text when the feed carries it besides the description, usually HTML
+	Content string
+	//the date as written in the feed, Published is zero if it could not be parsed
+	PublishedRaw string
+	Published    time.Time
+	//the media file attached to the item, like the audio of a podcast episode
+	EnclosureURL string
+}
+
+//details about how a feed was fetched
+type FetchMeta struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Bytes      int
+	Duration   time.Duration
+}
+
+const (
+	TypeRSS      = "rss"
+	TypeAtom     = "atom"
+	TypeJSONFeed = "jsonfeed"
+	TypeFile     = "file"
+	TypeHTML     = "html"
+	TypeSitemap  = "sitemap"
+	TypePage     = "page"
+)
+
+var registry = map[string]Source{}
+
+func init() {
+	Register(TypeRSS, httpSource{parse: ParseRSS})
+	Register(TypeAtom, httpSource{parse: ParseAtom})
+	Register(TypeJSONFeed, httpSource{parse: ParseJSONFeed})
+	Register(TypeFile, fileSource{})
+	Register(TypeHTML, htmlSource{})
+	Register(TypeSitemap, sitemapSource{})
+	Register(TypePage, pageSource{})
+}
+
+//make a source available for feeds of the given type, replacing any previous one
+func Register(feedType string, source Source) {
+	registry[feedType] = source
+}
+
+func Lookup(feedType string) (Source, bool) {
+	source, ok := registry[feedType]
+	return source, ok
+}
+
+//all registered feed types, sorted
+func Types() []string {
+	types := make([]string, 0, len(registry))
+	for feedType := range registry {
+		types = append(types, feedType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+//guess the format of a feed document, returns "" if it is none we know
+func Detect(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		return TypeJSONFeed
+	}
+	//the name of the root element tells RSS and Atom apart
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	//only the root element matters here, whatever the encoding
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "rss", "RDF":
+				return TypeRSS
+			case "feed":
+				return TypeAtom
+			}
+			return ""
+		}
+	}
+}
+
+//decode an XML document into v, reading encodings like ISO-8859-1 that the XML declaration names
+func unmarshalXML(data []byte, v any) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder.Decode(v)
+}
+
+//parse a feed document in whichever format it is in
+func Parse(data []byte) (*Result, error) {
+	switch Detect(data) {
+	case TypeRSS:
+		return ParseRSS(data)
+	case TypeAtom:
+		return ParseAtom(data)
+	case TypeJSONFeed:
+		return ParseJSONFeed(data)
+	}
+	return nil, fmt.Errorf("unrecognized feed format")
+}
+
+//layouts seen in the wild, tried in order
+var dateLayouts = []string{
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC3339,
+}
+
+func ParseDate(dateStr string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, dateStr)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Unable to parse date: %s", dateStr)
+}
+
+//fill in Published from PublishedRaw, leaving it zero when the date cannot be parsed
+func (item *Item) parseDate() {
+	if item.PublishedRaw == "" {
+		return
+	}
+	if t, err := ParseDate(item.PublishedRaw); err == nil {
+		item.Published = t
+	}
+}
@@ -0,0 +1,293 @@
+package sources
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	htmlcharset "golang.org/x/net/html/charset"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+const (
+	//feeds above these sizes are slow to fetch and parse on every poll. Nothing refuses
+	//larger feeds, errorFeedBytes only makes the advice an error
+	warnFeedBytes  = 1 << 20
+	errorFeedBytes = 10 << 20
+)
+
+//a problem found in a feed document
+type Issue struct {
+	Severity string
+	//1-based position of the item, 0 for problems with the feed itself
+	Item    int
+	Message string
+}
+
+var xmlEncodingDecl = regexp.MustCompile(`^<\?xml[^>]*encoding=["']([^"']+)["']`)
+
+//the encoding named in the XML declaration, "" if there is none
+func XMLEncoding(data []byte) string {
+	match := xmlEncodingDecl.FindSubmatch(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
+
+type validator struct {
+	issues []Issue
+}
+
+func (v *validator) add(severity string, item int, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Severity: severity, Item: item, Message: fmt.Sprintf(format, args...)})
+}
+
+//check a feed document against the RSS 2.0, Atom (RFC 4287) or JSON Feed 1.1 spec,
+//plus the things gator itself needs such as item links and dates it can parse
+func Validate(data []byte, contentType string) []Issue {
+	v := &validator{}
+	switch {
+	case len(data) > errorFeedBytes:
+		v.add(SeverityError, 0, "feed is %d bytes, publish fewer items or split the feed to keep it under %d bytes", len(data), errorFeedBytes)
+	case len(data) > warnFeedBytes:
+		v.add(SeverityWarning, 0, "feed is %d bytes, consider publishing fewer items", len(data))
+	}
+
+	format := Detect(data)
+	v.checkEncoding(data, contentType, format)
+	switch format {
+	case TypeRSS:
+		v.checkRSS(data)
+	case TypeAtom:
+		v.checkAtom(data)
+	case TypeJSONFeed:
+		v.checkJSONFeed(data)
+	default:
+		v.add(SeverityError, 0, "not an RSS, Atom or JSON Feed document")
+	}
+	return v.issues
+}
+
+func (v *validator) checkEncoding(data []byte, contentType, format string) {
+	charset := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		charset = params["charset"]
+	}
+	declared := ""
+	if format != TypeJSONFeed {
+		declared = XMLEncoding(data)
+	}
+	if declared != "" && !strings.EqualFold(declared, "utf-8") {
+		//the declaration decides how the document is read, whatever the Content-Type says
+		if encoding, _ := htmlcharset.Lookup(declared); encoding == nil {
+			v.add(SeverityError, 0, "XML declares encoding %s, which gator cannot read", declared)
+		}
+		return
+	}
+	if charset != "" && !strings.EqualFold(charset, "utf-8") {
+		v.add(SeverityWarning, 0, "Content-Type says charset=%s but the document is read as UTF-8", charset)
+	}
+	if !utf8.Valid(data) {
+		v.add(SeverityError, 0, "document is not valid UTF-8")
+	}
+}
+
+//links must be absolute, gator stores them as they are
+func (v *validator) checkLink(item int, what, link string) {
+	if link == "" {
+		return
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		v.add(SeverityError, item, "%s %q is not a valid URL", what, link)
+		return
+	}
+	if !u.IsAbs() {
+		v.add(SeverityError, item, "%s %q is relative", what, link)
+	}
+}
+
+func (v *validator) checkDate(item int, what, value string, parse func(string) (time.Time, error)) {
+	if value == "" {
+		v.add(SeverityWarning, item, "missing %s", what)
+		return
+	}
+	if _, err := parse(value); err != nil {
+		v.add(SeverityError, item, "%s %q cannot be parsed", what, value)
+	}
+}
+
+//only the first post with a link is stored, later ones are dropped as duplicates
+func (v *validator) checkDuplicates(item int, what, value string, seen map[string]int) {
+	if value == "" {
+		return
+	}
+	if first, ok := seen[value]; ok {
+		v.add(SeverityWarning, item, "%s %q already used by item %d", what, value, first)
+		return
+	}
+	seen[value] = item
+}
+
+func (v *validator) checkRSS(data []byte) {
+	var feed rssFeed
+	if err := unmarshalXML(data, &feed); err != nil {
+		v.add(SeverityError, 0, "invalid XML: %v", err)
+		return
+	}
+	channel := feed.Channel
+	if channel.Title == "" {
+		v.add(SeverityError, 0, "channel has no <title>")
+	}
+	if channel.Link == "" {
+		v.add(SeverityError, 0, "channel has no <link>")
+	}
+	if channel.Description == "" {
+		v.add(SeverityError, 0, "channel has no <description>")
+	}
+	v.checkLink(0, "channel link", channel.Link)
+	//RSS 1.0 items sit next to the channel, have no <guid> and are dated with <dc:date>
+	rdf := feed.XMLName.Local == "RDF"
+	items := append(channel.Item, feed.RDFItems...)
+	if len(items) == 0 {
+		v.add(SeverityInfo, 0, "channel has no items")
+	}
+	links, guids := map[string]int{}, map[string]int{}
+	for i, item := range items {
+		n := i + 1
+		if item.Title == "" && item.Description == "" {
+			v.add(SeverityError, n, "item needs a <title> or a <description>")
+		}
+		if item.Link == "" {
+			v.add(SeverityError, n, "item has no <link>, gator cannot store it")
+		}
+		if item.GUID == "" && !rdf {
+			v.add(SeverityWarning, n, "item has no <guid>")
+		}
+		v.checkLink(n, "link", item.Link)
+		switch {
+		case item.PubDate != "" || !rdf:
+			v.checkDate(n, "<pubDate>", item.PubDate, ParseDate)
+		default:
+			v.checkDate(n, "<dc:date>", item.DCDate, ParseDate)
+		}
+		v.checkDuplicates(n, "link", item.Link, links)
+		if first, ok := guids[item.GUID]; ok && item.GUID != "" {
+			v.add(SeverityError, n, "guid %q already used by item %d", item.GUID, first)
+		} else if item.GUID != "" {
+			guids[item.GUID] = n
+		}
+	}
+}
+
+func (v *validator) checkAtom(data []byte) {
+	var feed atomFeed
+	if err := unmarshalXML(data, &feed); err != nil {
+		v.add(SeverityError, 0, "invalid XML: %v", err)
+		return
+	}
+	if feed.ID == "" {
+		v.add(SeverityError, 0, "feed has no <id>")
+	}
+	if feed.Title == "" {
+		v.add(SeverityError, 0, "feed has no <title>")
+	}
+	if feed.Updated == "" {
+		v.add(SeverityError, 0, "feed has no <updated>")
+	} else if _, err := time.Parse(time.RFC3339, feed.Updated); err != nil {
+		v.add(SeverityError, 0, "feed <updated> %q is not an RFC 3339 date", feed.Updated)
+	}
+	for rel, href := range atomLinks(feed.Links) {
+		v.checkLink(0, rel+" link", href)
+	}
+	if len(feed.Entries) == 0 {
+		v.add(SeverityInfo, 0, "feed has no entries")
+	}
+	links, ids := map[string]int{}, map[string]int{}
+	for i, entry := range feed.Entries {
+		n := i + 1
+		if entry.ID == "" {
+			v.add(SeverityError, n, "entry has no <id>")
+		}
+		if entry.Title == "" {
+			v.add(SeverityError, n, "entry has no <title>")
+		}
+		if entry.Updated == "" {
+			v.add(SeverityError, n, "entry has no <updated>")
+		}
+		link := atomLinks(entry.Links)["alternate"]
+		if link == "" {
+			v.add(SeverityError, n, "entry has no alternate <link>, gator cannot store it")
+		}
+		v.checkLink(n, "link", link)
+		published := entry.Published
+		if published == "" {
+			published = entry.Updated
+		}
+		if published != "" {
+			v.checkDate(n, "date", published, ParseDate)
+		}
+		v.checkDuplicates(n, "link", link, links)
+		if first, ok := ids[entry.ID]; ok && entry.ID != "" {
+			v.add(SeverityError, n, "id %q already used by entry %d", entry.ID, first)
+		} else if entry.ID != "" {
+			ids[entry.ID] = n
+		}
+	}
+}
+
+func (v *validator) checkJSONFeed(data []byte) {
+	var feed jsonFeed
+	if err := json.Unmarshal(data, &feed); err != nil {
+		v.add(SeverityError, 0, "invalid JSON: %v", err)
+		return
+	}
+	if !strings.HasPrefix(feed.Version, "https://jsonfeed.org/version/") {
+		v.add(SeverityError, 0, "version %q is not a JSON Feed version URL", feed.Version)
+	}
+	if feed.Title == "" {
+		v.add(SeverityError, 0, "feed has no title")
+	}
+	v.checkLink(0, "home_page_url", feed.HomePageURL)
+	v.checkLink(0, "feed_url", feed.FeedURL)
+	if len(feed.Items) == 0 {
+		v.add(SeverityInfo, 0, "feed has no items")
+	}
+	links, ids := map[string]int{}, map[string]int{}
+	for i, item := range feed.Items {
+		n := i + 1
+		id := strings.Trim(string(item.ID), `"`)
+		if id == "" || id == "null" {
+			v.add(SeverityError, n, "item has no id")
+		} else if first, ok := ids[id]; ok {
+			v.add(SeverityError, n, "id %q already used by item %d", id, first)
+		} else {
+			ids[id] = n
+		}
+		if item.ContentHTML == "" && item.ContentText == "" {
+			v.add(SeverityError, n, "item needs content_html or content_text")
+		}
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+		if link == "" {
+			v.add(SeverityError, n, "item has no url, gator cannot store it")
+		}
+		v.checkLink(n, "url", link)
+		v.checkDate(n, "date_published", item.DatePublished, ParseDate)
+		v.checkDuplicates(n, "url", link, links)
+	}
+}
@@ -0,0 +1,128 @@
+package sources
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		contentType string
+		//"severity item: message" of every issue
+		want []string
+	}{
+		{
+			name: "valid rss 2.0",
+			doc: `<rss version="2.0"><channel><title>Blog</title><link>https://example.com/</link><description>Posts</description>
+<item><title>One</title><link>https://example.com/1</link><guid>1</guid><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+</channel></rss>`,
+			contentType: "application/rss+xml; charset=utf-8",
+		},
+		{
+			name: "rss 2.0 item problems",
+			doc: `<rss version="2.0"><channel><title>Blog</title><link>https://example.com/</link><description>Posts</description>
+<item><title>One</title><link>/1</link><pubDate>yesterday</pubDate></item>
+<item><description>Two</description><guid>2</guid></item>
+</channel></rss>`,
+			want: []string{
+				"warning 1: item has no <guid>",
+				`error 1: link "/1" is relative`,
+				`error 1: <pubDate> "yesterday" cannot be parsed`,
+				"error 2: item has no <link>, gator cannot store it",
+				"warning 2: missing <pubDate>",
+			},
+		},
+		{
+			name: "rss 2.0 without items",
+			doc:  `<rss version="2.0"><channel><title>Blog</title><link>https://example.com/</link><description>Posts</description></channel></rss>`,
+			want: []string{"info 0: channel has no items"},
+		},
+		{
+			name: "valid rss 1.0",
+			doc: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>Blog</title><link>https://example.com/</link><description>Posts</description></channel>
+<item><title>One</title><link>https://example.com/1</link><dc:date>2006-01-02T15:04:05Z</dc:date></item>
+</rdf:RDF>`,
+		},
+		{
+			name: "rss 1.0 item without a date",
+			doc: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+<channel><title>Blog</title><link>https://example.com/</link><description>Posts</description></channel>
+<item><title>One</title><link>https://example.com/1</link></item>
+</rdf:RDF>`,
+			want: []string{"warning 1: missing <dc:date>"},
+		},
+		{
+			name: "valid atom",
+			doc: `<feed xmlns="http://www.w3.org/2005/Atom"><id>urn:blog</id><title>Blog</title><updated>2006-01-02T15:04:05Z</updated>
+<entry><id>urn:1</id><title>One</title><updated>2006-01-02T15:04:05Z</updated><link href="https://example.com/1"/></entry>
+</feed>`,
+		},
+		{
+			name: "atom entry problems",
+			doc: `<feed xmlns="http://www.w3.org/2005/Atom"><id>urn:blog</id><title>Blog</title><updated>2006-01-02</updated>
+<entry><id>urn:1</id><title>One</title><updated>2006-01-02T15:04:05Z</updated></entry>
+</feed>`,
+			want: []string{
+				`error 0: feed <updated> "2006-01-02" is not an RFC 3339 date`,
+				"error 1: entry has no alternate <link>, gator cannot store it",
+			},
+		},
+		{
+			name: "valid json feed",
+			doc: `{"version":"https://jsonfeed.org/version/1.1","title":"Blog","home_page_url":"https://example.com/",
+"items":[{"id":"1","url":"https://example.com/1","content_text":"One","date_published":"2006-01-02T15:04:05Z"}]}`,
+		},
+		{
+			name: "json feed item problems",
+			doc: `{"version":"1.1","title":"Blog",
+"items":[{"id":"1","url":"https://example.com/1","content_text":"One"},{"id":"1","url":"https://example.com/1"}]}`,
+			want: []string{
+				`error 0: version "1.1" is not a JSON Feed version URL`,
+				"warning 1: missing date_published",
+				`error 2: id "1" already used by item 1`,
+				"error 2: item needs content_html or content_text",
+				"warning 2: missing date_published",
+				`warning 2: url "https://example.com/1" already used by item 1`,
+			},
+		},
+		{
+			name: "encoding the xml declaration names",
+			doc: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss version=\"2.0\"><channel><title>Caf\xe9</title><link>https://example.com/</link><description>Posts</description>\n" +
+				"<item><title>Caf\xe9</title><link>https://example.com/1</link><guid>1</guid><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>\n" +
+				"</channel></rss>",
+		},
+		{
+			name: "encoding gator cannot read",
+			doc: `<?xml version="1.0" encoding="x-klingon"?><rss version="2.0"><channel><title>Blog</title><link>https://example.com/</link><description>Posts</description>
+</channel></rss>`,
+			want: []string{
+				"error 0: XML declares encoding x-klingon, which gator cannot read",
+				`error 0: invalid XML: xml: opening charset "x-klingon": unsupported charset: "x-klingon"`,
+			},
+		},
+		{
+			name:        "not a feed",
+			doc:         `<html><body></body></html>`,
+			contentType: "text/html; charset=iso-8859-1",
+			want: []string{
+				"warning 0: Content-Type says charset=iso-8859-1 but the document is read as UTF-8",
+				"error 0: not an RSS, Atom or JSON Feed document",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, issue := range Validate([]byte(tt.doc), tt.contentType) {
+				got = append(got, fmt.Sprintf("%v %v: %v", issue.Severity, issue.Item, issue.Message))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/max-durnea/blog-aggregator/internal/config"
+)
+
+//logging settings from the global flags, they override the config file
+type logOptions struct {
+	level  string
+	format string
+	file   string
+}
+
+//the logging flags, part of the global flags parsed in main
+func (opts *logOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.level, "log-level", "", "debug, info, warn or error (default info)")
+	fs.StringVar(&opts.format, "log-format", "", "text or json (default text)")
+	fs.StringVar(&opts.file, "log-file", "", "append logs to this file instead of stderr")
+}
+
+//build the default logger from the config and the flags, the returned file (if any) must be closed
+func setupLogger(cfg config.Config, opts logOptions) (io.Closer, error) {
+	level := firstNonEmpty(opts.level, cfg.LogLevel, "info")
+	format := firstNonEmpty(opts.format, cfg.LogFormat, "text")
+	file := firstNonEmpty(opts.file, cfg.LogFile)
+
+	var slogLevel slog.Level
+	if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	var out io.Writer = os.Stderr
+	var closer io.Closer
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		out, closer = f, f
+	}
+	handlerOpts := &slog.HandlerOptions{Level: slogLevel}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, fmt.Errorf("invalid log format %q, use text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return closer, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -1,88 +1,283 @@
-package main
-
-import (
-	"fmt"
-	"os"
-	"database/sql"
-
-	_ "github.com/lib/pq"
-	"github.com/max-durnea/blog-aggregator/internal/config"
-	"github.com/max-durnea/blog-aggregator/internal/database"
-)
-//maintain the state, here we have the Config struct which is built by reading the config file
-type state struct{
-	db *database.Queries
-	cfg *config.Config
-}
-
-type command struct{
-	name string
-	args []string
-}
-//store the commands in a map of name->function
-type commands struct{
-	handlers map[string]func(*state, command) error
-}
-
-//run a command
-func (c *commands) run(s *state, cmd command){
-	handler,ok := c.handlers[cmd.name]
-	if !ok {
-		fmt.Printf("ERROR: The provided command does not exist\n")
-		return
-	}
-	err:=handler(s,cmd)
-	if err != nil{
-		fmt.Printf("%v\n",err)
-		os.Exit(1)
-	}
-}
-//register a new command
-func (c *commands) register(name string, f func(*state, command) error){
-	c.handlers[name]=f
-}
-func main(){
-	//initialize config, state, commands structs to use them later
-	var cfg config.Config
-	st := state{}
-	st.cfg = &cfg
-	cmds := commands{
-    	handlers: map[string]func(*state, command) error{},
-	}
-	//read the config file into the Config struct
-	cfg,err:=config.Read()
-	if err!=nil {
-		fmt.Printf("ERROR: Failed to read config: %v\n", err)
-		os.Exit(1)
-	}
-	//Open Connection to the database
-	db, err := sql.Open("postgres",st.cfg.DB_url)
-	st.db = database.New(db)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to open database connection: %v\n", err)
-		os.Exit(1)
-	}
-
-	//Here we add new commands
-	cmds.register("login",handlerLogin)
-	cmds.register("register", handlerRegister)
-	cmds.register("reset", handlerReset)
-	cmds.register("users", handlerUsers)
-	cmds.register("agg", agg)
-	cmds.register("addfeed",middlewareLoggedIn(handlerFeed))
-	cmds.register("feeds",handlerAllFeeds)
-	cmds.register("follow",middlewareLoggedIn(handlerFollow))
-	cmds.register("following",middlewareLoggedIn(handlerFollows))
-	cmds.register("unfollow",middlewareLoggedIn(handlerUnfollow))
-	cmds.register("browse",middlewareLoggedIn(handlerBrowse))
-	//Get the command line arguments
-	args:=os.Args
-	if(len(args)<2){
-		fmt.Println("ERROR: No arguments provided!")
-		os.Exit(1)
-	}
-	//Execute the command
-	cmd := command{name : args[1], args : args[2:]}
-	cmds.run(&st,cmd)
-	
-}
\ No newline at end of file
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/max-durnea/blog-aggregator/internal/config"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+)
+//maintain the state, here we have the Config struct which is built by reading the config file
+type state struct{
+	db *database.Queries
+	//the connection behind db, for queries that need a transaction
+	conn *sql.DB
+	cfg *config.Config
+	//only set while agg runs a WebSub callback server
+	websub *webSub
+	//only set while agg runs
+	health *aggHealth
+	//only set while the shell runs
+	session *shellSession
+	//results of commands go here, in the format of --output
+	out *output
+}
+
+func main(){
+	//initialize config, state, commands structs to use them later
+	var cfg config.Config
+	st := state{}
+	st.cfg = &cfg
+	cmds := newCommands()
+	//global flags like --log-level come before the command
+	var logOpts logOptions
+	globalFlags := flag.NewFlagSet("gator", flag.ContinueOnError)
+	logOpts.addFlags(globalFlags)
+	timeout := globalFlags.String("timeout", "", "cancel a command after this long, 0 for no limit (default 1m)")
+	outputName := globalFlags.String("output", "", "text, json, jsonl, csv or table (default text)")
+	if err := globalFlags.Parse(os.Args[1:]); err != nil {
+		os.Exit(exitCodes[kindInvalidArgument])
+	}
+	args := globalFlags.Args()
+	//read the config file into the Config struct
+	cfg,err:=config.Read()
+	if err!=nil {
+		slog.Error("Failed to read config", "err", err)
+		os.Exit(1)
+	}
+	logFile, err := setupLogger(cfg, logOpts)
+	if err != nil {
+		slog.Error("Failed to set up logging", "err", err)
+		os.Exit(1)
+	}
+	cmds.timeout, err = cfg.CommandTimeoutDuration()
+	if *timeout != "" {
+		cmds.timeout, err = time.ParseDuration(*timeout)
+	}
+	if err != nil {
+		slog.Error("Invalid command timeout", "err", err)
+		os.Exit(exitCodes[kindInvalidArgument])
+	}
+	format, err := parseOutputFormat(firstNonEmpty(*outputName, cfg.Output, string(outputText)))
+	if err != nil {
+		slog.Error("Invalid output format", "err", err)
+		os.Exit(exitCodes[kindInvalidArgument])
+	}
+	st.out = &output{format: format, w: os.Stdout}
+	//Open Connection to the database
+	db, err := sql.Open("postgres",st.cfg.DB_url)
+	if err != nil {
+		slog.Error("Failed to open database connection", "err", err)
+		os.Exit(1)
+	}
+	st.db = database.New(timedDB{db: db})
+	st.conn = db
+
+	//Here we add new commands
+	registerCommands(cmds)
+	//Get the command line arguments
+	if(len(args)<1){
+		//without a command, show what there is
+		args = []string{"help"}
+	}
+	//Ctrl-C or SIGTERM cancels the command, a second one kills gator the usual way.
+	//In the shell Ctrl-C only cancels the command it runs
+	signals := []os.Signal{os.Interrupt, syscall.SIGTERM}
+	if cmds.interactive(args[0]) {
+		signals = []os.Signal{syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), signals...)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	//Execute the command
+	cmd := command{name : args[0], args : args[1:]}
+	code := cmds.run(ctx,&st,cmd)
+	if logFile != nil {
+		logFile.Close()
+	}
+	os.Exit(code)
+	
+}
+
+//all commands of gator, see commandSpec
+func registerCommands(cmds *commands) {
+	cmds.register(commandSpec{
+		name:    "help",
+		summary: "List the commands or show the details of one",
+		args:    []argSpec{{name: "command", description: "the command to explain", optional: true, complete: cmds.completeCommandNames}},
+		handler: cmds.handlerHelp,
+	})
+	cmds.register(commandSpec{
+		name:    "login",
+		summary: "Switch to an existing user",
+		args:    []argSpec{{name: "name", description: "name of the user", complete: completeUserNames}},
+		handler: handlerLogin,
+	})
+	cmds.register(commandSpec{
+		name:    "register",
+		summary: "Create a user and switch to it",
+		args:    []argSpec{{name: "name", description: "name of the new user"}},
+		handler: handlerRegister,
+	})
+	cmds.register(commandSpec{
+		name:    "reset",
+		summary: "Delete all users, feeds and posts",
+		handler: handlerReset,
+	})
+	cmds.register(commandSpec{
+		name:    "users",
+		summary: "List the users, marking the current one",
+		handler: handlerUsers,
+	})
+	cmds.register(commandSpec{
+		name:    "agg",
+		summary: "Fetch feeds continuously, one per worker every interval, until stopped",
+		args:    []argSpec{{name: "interval", description: "time between fetches, like 30s, 5m or 1h"}},
+		flags: []flagSpec{
+			{name: "workers", usage: "number of feeds fetched in parallel every interval", value: 1},
+			{name: "fetch-timeout", usage: "deadline for fetching and storing a single feed", value: 30 * time.Second},
+			{name: "shutdown-timeout", usage: "how long in-flight fetches may take to finish after SIGINT/SIGTERM", value: 10 * time.Second},
+			{name: "websub-listen", usage: "address for the WebSub callback server to listen on (default :8080)", value: ""},
+			{name: "websub-callback", usage: "public URL of the WebSub callback server", value: ""},
+			{name: "metrics-addr", usage: "address to serve Prometheus metrics and health checks on, e.g. :9090", value: ""},
+			{name: "liveness-window", usage: "/healthz fails when no feed was processed for this long (default 5 times the interval, at least 5m)", value: time.Duration(0)},
+		},
+		longRunning: true,
+		handler:     agg,
+	})
+	cmds.register(commandSpec{
+		name:    "addfeed",
+		summary: "Add a feed and follow it",
+		args: []argSpec{
+			{name: "name", description: "name of the feed"},
+			{name: "url", description: "URL of the feed, file:// for local files"},
+			{name: "type", description: "feed type (default rss, file for file:// URLs)", optional: true},
+			{name: "key=value", description: "settings of the feed type, e.g. item=.post for html feeds", optional: true, repeated: true},
+		},
+		userHandler: handlerFeed,
+	})
+	cmds.register(commandSpec{
+		name:    "feeds",
+		summary: "List all feeds with the users who added them",
+		flags:   []flagSpec{{name: "sort", usage: "order by name, url or created", value: "created", complete: choices("name", "url", "created")}},
+		handler: handlerAllFeeds,
+	})
+	cmds.register(commandSpec{
+		name:        "follow",
+		summary:     "Follow a feed that was already added",
+		args:        []argSpec{{name: "url", description: "URL of the feed", complete: completeFeedURLs}},
+		userHandler: handlerFollow,
+	})
+	cmds.register(commandSpec{
+		name:        "following",
+		summary:     "List the feeds you follow",
+		userHandler: handlerFollows,
+	})
+	cmds.register(commandSpec{
+		name:        "unfollow",
+		summary:     "Stop following a feed",
+		args:        []argSpec{{name: "url", description: "URL of the feed", complete: completeFollowedURLs}},
+		userHandler: handlerUnfollow,
+	})
+	cmds.register(commandSpec{
+		name:        "browse",
+		summary:     "Show the latest posts of the feeds you follow and mark them read",
+		args:        []argSpec{{name: "limit", description: "number of posts, same as --limit", optional: true}},
+		flags: []flagSpec{
+			{name: "limit", usage: "number of posts", value: 2},
+			{name: "feed", usage: "only posts of this feed, by name or URL, repeat for more feeds", value: []string(nil), complete: completeFeedNames},
+			{name: "since", usage: "only posts published within this long, e.g. 24h", value: time.Duration(0)},
+			{name: "from", usage: "only posts published on or after this date, e.g. 2024-05-01", value: ""},
+			{name: "to", usage: "only posts published up to this date, the whole day included", value: ""},
+			{name: "match", usage: "only posts whose title or description contains this text, ignoring case", value: ""},
+			{name: "regex", usage: "only posts whose title or description matches this regular expression, ignoring case", value: ""},
+			{name: "enclosure", usage: "only posts with an enclosure, like podcast episodes", value: false},
+			{name: "unread", usage: "only posts not shown before", value: false},
+			{name: "before", usage: "the page of older posts after this cursor", value: ""},
+			{name: "after", usage: "the page of newer posts before this cursor", value: ""},
+			{name: "page", usage: "page number, counted from the cursor if there is one", value: 1},
+		},
+		userHandler: handlerBrowse,
+	})
+	cmds.register(commandSpec{
+		name:    "search",
+		summary: "Find posts by their words with Postgres full-text search",
+		args:    []argSpec{{name: "query", description: `words to find, "quoted phrases", or and -word to leave out`, repeated: true}},
+		flags: []flagSpec{
+			{name: "limit", usage: "number of results", value: 10},
+			{name: "all", usage: "search every feed, not only the ones you follow", value: false},
+			{name: "language", usage: "text search configuration, e.g. german (default search_language from the config, or english)", value: ""},
+		},
+		userHandler: handlerSearch,
+	})
+	cmds.register(commandSpec{
+		name:        "reader",
+		summary:     "Read the feeds you follow full-screen, updated live while agg runs",
+		flags:       []flagSpec{{name: "limit", usage: "number of posts listed per feed", value: 200}},
+		longRunning: true,
+		userHandler: handlerReader,
+	})
+	cmds.register(commandSpec{
+		name:    "ingest",
+		summary: "Store the posts of a feed document from a file or stdin",
+		args: []argSpec{
+			{name: "file", description: "path of the document, - for stdin"},
+			{name: "feed_url", description: "feed to store the posts in, taken from the self link if missing", optional: true},
+		},
+		handler: handlerIngest,
+	})
+	cmds.register(commandSpec{
+		name:    "preview",
+		summary: "Fetch a feed and show what gator would get out of it, without storing anything",
+		args: []argSpec{
+			{name: "url", description: "URL of the feed"},
+			{name: "n", description: "number of items to show (default 5)", optional: true},
+		},
+		handler: handlerPreview,
+	})
+	cmds.register(commandSpec{
+		name:    "validate",
+		summary: "Check a feed against its spec and list the problems",
+		args:    []argSpec{{name: "feed", description: "URL or name of the feed", complete: completeFeedNames}},
+		handler: handlerValidate,
+	})
+	cmds.register(commandSpec{
+		name:    "fetchlog",
+		summary: "Show recent fetch attempts, newest first",
+		args:    []argSpec{{name: "feed", description: "name or URL of a feed to show only its attempts", optional: true, complete: completeFeedNames}},
+		flags: []flagSpec{
+			{name: "since", usage: "only attempts started within this long", value: 24 * time.Hour},
+			{name: "limit", usage: "maximum number of attempts to show", value: 50},
+		},
+		handler: handlerFetchLog,
+	})
+	cmds.register(commandSpec{
+		name:        "shell",
+		summary:     "Run commands at an interactive prompt on one connection",
+		longRunning: true,
+		interactive: true,
+		handler:     cmds.handlerShell,
+	})
+	cmds.register(commandSpec{
+		name:    "completion",
+		summary: "Print the shell completion script for bash, zsh or fish",
+		args:    []argSpec{{name: "shell", description: "bash, zsh or fish", complete: choices("bash", "zsh", "fish")}},
+		handler: handlerCompletion,
+	})
+	cmds.register(commandSpec{
+		name:    "__complete",
+		summary: "Print completions for the words typed so far, used by the completion scripts",
+		args:    []argSpec{{name: "word", description: "words after gator, the last one is being completed", optional: true, repeated: true}},
+		hidden:  true,
+		handler: cmds.handlerComplete,
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/max-durnea/blog-aggregator/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//metrics are always collected, agg only serves them when --metrics-addr is set
+var (
+	fetchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gator_fetches_total",
+		Help: "Feed fetches by HTTP status, \"error\" when there was no response and \"cancelled\" when agg stopped mid-fetch.",
+	}, []string{"status"})
+	fetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gator_fetch_duration_seconds",
+		Help:    "Time taken to fetch, parse and store a feed.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"feed_type"})
+	postsInserted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gator_posts_inserted_total",
+		Help: "Posts stored for the first time.",
+	})
+	postsUpdated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gator_posts_updated_total",
+		Help: "Stored posts refreshed because the source reported a newer version.",
+	})
+	duplicatesSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gator_duplicates_skipped_total",
+		Help: "Feed items skipped because a post with the same URL was already stored.",
+	})
+	feedsDue = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gator_feeds_due",
+		Help: "Polled feeds not fetched within one round, the agg interval times the number of polled feeds per worker.",
+	})
+	feedsErroring = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gator_feeds_erroring",
+		Help: "Feeds whose latest fetch attempt failed.",
+	})
+	schedulerLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gator_scheduler_lag_seconds",
+		Help: "How long the most overdue feed has been waiting past its round.",
+	})
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gator_db_query_duration_seconds",
+		Help:    "Database query latency by sqlc query name.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"query"})
+)
+
+var metricsRegistry = prometheus.NewRegistry()
+
+func init() {
+	metricsRegistry.MustRegister(
+		fetchesTotal, fetchDuration, postsInserted, postsUpdated, duplicatesSkipped,
+		feedsDue, feedsErroring, schedulerLag, dbQueryDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+//the HTTP listener of agg: metrics plus the health checks for orchestrators
+func newMetricsServer(addr string, s *state) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /healthz", s.health.handleLiveness)
+	mux.HandleFunc("GET /readyz", handleReadiness(s))
+	return &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+}
+
+//count a finished fetch attempt
+func (a *fetchAttempt) observe() {
+	status := "error"
+	switch {
+	case a.released:
+		status = "cancelled"
+	case a.meta.StatusCode != 0:
+		status = strconv.Itoa(a.meta.StatusCode)
+	}
+	fetchesTotal.WithLabelValues(status).Inc()
+	fetchDuration.WithLabelValues(a.feedType).Observe(time.Since(a.started).Seconds())
+}
+
+//refresh the gauges that describe the schedule as a whole. Every tick the workers fetch
+//a feed each, so every feed gets one fetch per round of interval times the ticks it
+//takes to get through all polled feeds
+func updateScheduleMetrics(ctx context.Context, s *state, interval time.Duration, workers int) {
+	feeds, err := s.db.GetPollableFeeds(ctx, s.websub != nil)
+	if err != nil {
+		slog.Error("Failed to load feeds for metrics", "err", err)
+		return
+	}
+	ticks := (len(feeds) + workers - 1) / workers
+	round := interval * time.Duration(ticks)
+	now := time.Now()
+	due := 0
+	var lag time.Duration
+	for _, feed := range feeds {
+		last := feed.CreatedAt
+		if feed.LastFetchedAt.Valid {
+			last = feed.LastFetchedAt.Time
+		}
+		if late := now.Sub(last.Add(round)); late > 0 {
+			due++
+			lag = max(lag, late)
+		}
+	}
+	feedsDue.Set(float64(due))
+	schedulerLag.Set(lag.Seconds())
+
+	erroring, err := s.db.CountErroringFeeds(ctx)
+	if err != nil {
+		slog.Error("Failed to count erroring feeds for metrics", "err", err)
+		return
+	}
+	feedsErroring.Set(float64(erroring))
+}
+
+//database.DBTX that times every query, labelled with the sqlc query name
+type timedDB struct {
+	db database.DBTX
+}
+
+func (t timedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	return t.db.ExecContext(ctx, query, args...)
+}
+
+func (t timedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.db.PrepareContext(ctx, query)
+}
+
+func (t timedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return t.db.QueryContext(ctx, query, args...)
+}
+
+func (t timedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer observeQuery(query, time.Now())
+	return t.db.QueryRowContext(ctx, query, args...)
+}
+
+//sqlc starts every query with "-- name: <Name> :<kind>"
+func observeQuery(query string, started time.Time) {
+	name := "unknown"
+	if rest, ok := strings.CutPrefix(query, "-- name: "); ok {
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			name = fields[0]
+		}
+	}
+	dbQueryDuration.WithLabelValues(name).Observe(time.Since(started).Seconds())
+}
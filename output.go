@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+//how commands print their results, chosen with the global --output flag
+type outputFormat string
+
+const (
+	outputText  outputFormat = "text"
+	outputJSON  outputFormat = "json"
+	outputJSONL outputFormat = "jsonl"
+	outputCSV   outputFormat = "csv"
+	outputTable outputFormat = "table"
+)
+
+func parseOutputFormat(name string) (outputFormat, error) {
+	switch format := outputFormat(strings.ToLower(name)); format {
+	case outputText, outputJSON, outputJSONL, outputCSV, outputTable:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid output format %q, use text, json, jsonl, csv or table", name)
+}
+
+//where the results of commands go. Records are structs whose json tags are the field
+//names in every machine-readable format, the text format is up to each command
+type output struct {
+	format outputFormat
+	w      io.Writer
+}
+
+//print a line for people, in the text format only
+func (out *output) message(format string, args ...any) {
+	if out.format == outputText {
+		fmt.Fprintf(out.w, format+"\n", args...)
+	}
+}
+
+//print a list of records, text prints each one
+func writeList[T any](out *output, records []T, text func(w io.Writer, record T)) error {
+	switch out.format {
+	case outputJSON:
+		if records == nil {
+			//scripts expect an empty array, not null
+			records = []T{}
+		}
+		encoder := newEncoder(out.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case outputJSONL:
+		encoder := newEncoder(out.w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputCSV:
+		header, rows := tabulate(records)
+		writer := csv.NewWriter(out.w)
+		writer.Write(header)
+		writer.WriteAll(rows)
+		return writer.Error()
+	case outputTable:
+		header, rows := tabulate(records)
+		writer := tabwriter.NewWriter(out.w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			for i, cell := range row {
+				//keep every record on one line
+				row[i] = strings.Join(strings.Fields(cell), " ")
+			}
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+	for _, record := range records {
+		text(out.w, record)
+	}
+	return nil
+}
+
+//print one record, like the feed addfeed created. JSON gets an object instead of an array
+func writeRecord[T any](out *output, record T, text func(w io.Writer, record T)) error {
+	if out.format == outputJSON {
+		encoder := newEncoder(out.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(record)
+	}
+	return writeList(out, []T{record}, text)
+}
+
+//a JSON encoder that leaves <, > and & in titles and URLs alone
+func newEncoder(w io.Writer) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder
+}
+
+//the json field names of a record type and the records as rows of strings
+func tabulate[T any](records []T) ([]string, [][]string) {
+	recordType := reflect.TypeFor[T]()
+	var header []string
+	var fields []int
+	for i := range recordType.NumField() {
+		name, _, _ := strings.Cut(recordType.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		value := reflect.ValueOf(record)
+		row := make([]string, 0, len(fields))
+		for _, i := range fields {
+			row = append(row, formatCell(value.Field(i)))
+		}
+		rows = append(rows, row)
+	}
+	return header, rows
+}
+
+//a field as text: times in RFC 3339 like in JSON, nil pointers empty,
+//lists and nested records as JSON
+func formatCell(value reflect.Value) string {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		if value.Kind() != reflect.Struct && value.IsNil() {
+			return ""
+		}
+		var sb strings.Builder
+		newEncoder(&sb).Encode(value.Interface())
+		return strings.TrimSuffix(sb.String(), "\n")
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+//the optional time of a record, nil for SQL NULL so JSON shows null
+func nullTime(valid bool, t time.Time) *time.Time {
+	if !valid {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTabulate(t *testing.T) {
+	type item struct {
+		Title string `json:"title"`
+	}
+	type record struct {
+		Name     string     `json:"name"`
+		Count    int        `json:"count,omitempty"`
+		At       *time.Time `json:"at"`
+		Tags     []string   `json:"tags"`
+		Items    []item     `json:"items"`
+		Skipped  string     `json:"-"`
+		private  string
+		Untagged string
+	}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		records []record
+		rows    [][]string
+	}{
+		{"no records", nil, [][]string{}},
+		{"values", []record{{Name: "a", Count: 2, At: &at, Tags: []string{"x", "y"}, Items: []item{{"<b>"}}, Skipped: "s", private: "p", Untagged: "u"}},
+			[][]string{{"a", "2", "2024-05-01T12:00:00Z", `["x","y"]`, `[{"title":"<b>"}]`}}},
+		{"nil pointer and lists are empty", []record{{Name: "b"}},
+			[][]string{{"b", "0", "", "", ""}}},
+	}
+	wantHeader := []string{"name", "count", "at", "tags", "items"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, rows := tabulate(tt.records)
+			if !slices.Equal(header, wantHeader) {
+				t.Errorf("header = %q, want %q", header, wantHeader)
+			}
+			if !slices.EqualFunc(rows, tt.rows, slices.Equal) {
+				t.Errorf("rows = %q, want %q", rows, tt.rows)
+			}
+		})
+	}
+}
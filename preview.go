@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/max-durnea/blog-aggregator/internal/sources"
+)
+
+//response headers that tell how the feed may be cached and revalidated
+var cacheHeaders = []string{"Cache-Control", "ETag", "Last-Modified", "Expires", "Age"}
+
+//fetch and parse a feed and report what we would get out of it, without touching the database:
+//preview <url> [number of items]
+func handlerPreview(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) < 1 || len(cmd.args) > 2 {
+		return invalidArgument("provide the url and optionally the number of items to show")
+	}
+	feedURL := cmd.args[0]
+	limit := 5
+	if len(cmd.args) == 2 {
+		parsed, err := strconv.Atoi(cmd.args[1])
+		if err != nil || parsed < 0 {
+			return invalidArgument("invalid number of items: %v", cmd.args[1])
+		}
+		limit = parsed
+	}
+
+	data, meta, err := fetchDocument(ctx, feedURL)
+	if err != nil {
+		if meta.StatusCode != 0 {
+			return fmt.Errorf("could not fetch feed (HTTP %v): %w", meta.StatusCode, err)
+		}
+		return fmt.Errorf("could not fetch feed: %w", err)
+	}
+	record := previewRecord{
+		URL:          feedURL,
+		Bytes:        meta.Bytes,
+		DurationMs:   meta.Duration.Milliseconds(),
+		Encoding:     detectEncoding(meta.Header.Get("Content-Type"), data),
+		CacheHeaders: map[string]string{},
+	}
+	if meta.StatusCode != 0 {
+		record.HTTPStatus = &meta.StatusCode
+	}
+	for _, header := range cacheHeaders {
+		if value := meta.Header.Get(header); value != "" {
+			record.CacheHeaders[header] = value
+		}
+	}
+
+	format := sources.Detect(data)
+	if format == "" {
+		return fmt.Errorf("not a feed we can parse (RSS, Atom or JSON Feed), content preview: %.200s...", data)
+	}
+	feed, err := sources.Parse(data)
+	if err != nil {
+		return fmt.Errorf("detected %v but could not parse it: %w", format, err)
+	}
+	record.Format = feed.Format
+	record.Title = feed.Title
+	record.Link = feed.Link
+	record.Hub = feed.Links["hub"]
+	record.Items = len(feed.Items)
+
+	//dates we could not read end up at the bottom of browse
+	for _, item := range feed.Items {
+		switch {
+		case item.PublishedRaw == "":
+			record.MissingDates++
+		case item.Published.IsZero():
+			record.UnparseableDates = append(record.UnparseableDates, item.PublishedRaw)
+		}
+	}
+
+	items := append([]sources.Item(nil), feed.Items...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Published.After(items[j].Published)
+	})
+	if limit > len(items) {
+		limit = len(items)
+	}
+	for _, item := range items[:limit] {
+		record.Latest = append(record.Latest, previewItemRecord{
+			Title:       item.Title,
+			Link:        item.Link,
+			PublishedAt: nullTime(!item.Published.IsZero(), item.Published),
+		})
+	}
+	return writeRecord(s.out, record, printPreview)
+}
+
+func printPreview(w io.Writer, preview previewRecord) {
+	if preview.HTTPStatus != nil {
+		fmt.Fprintf(w, "HTTP status:  %v (%v bytes in %v)\n", *preview.HTTPStatus, preview.Bytes, time.Duration(preview.DurationMs)*time.Millisecond)
+	}
+	fmt.Fprintf(w, "Encoding:     %v\n", preview.Encoding)
+	for _, header := range cacheHeaders {
+		if value := preview.CacheHeaders[header]; value != "" {
+			fmt.Fprintf(w, "%-13v %v\n", header+":", value)
+		}
+	}
+	fmt.Fprintf(w, "Format:       %v\n", preview.Format)
+	fmt.Fprintf(w, "Title:        %v\n", preview.Title)
+	if preview.Link != "" {
+		fmt.Fprintf(w, "Link:         %v\n", preview.Link)
+	}
+	if preview.Hub != "" {
+		fmt.Fprintf(w, "WebSub hub:   %v\n", preview.Hub)
+	}
+	fmt.Fprintf(w, "Items:        %v\n", preview.Items)
+	if preview.MissingDates > 0 {
+		fmt.Fprintf(w, "Missing dates: %v\n", preview.MissingDates)
+	}
+	if len(preview.UnparseableDates) > 0 {
+		fmt.Fprintf(w, "Unparseable dates: %v\n", len(preview.UnparseableDates))
+		for _, raw := range preview.UnparseableDates {
+			fmt.Fprintf(w, " ! %q\n", raw)
+		}
+	}
+	if len(preview.Latest) > 0 {
+		fmt.Fprintf(w, "Latest %v items:\n", len(preview.Latest))
+	}
+	for _, item := range preview.Latest {
+		date := "no date"
+		if item.PublishedAt != nil {
+			date = item.PublishedAt.Format(time.RFC1123)
+		}
+		fmt.Fprintf(w, "* %v\n - %v\n = %v\n\n", item.Title, date, item.Link)
+	}
+}
+
+//the raw feed document behind a URL, read directly for file:// URLs
+func fetchDocument(ctx context.Context, feedURL string) ([]byte, sources.FetchMeta, error) {
+	if !strings.HasPrefix(feedURL, sources.FilePrefix) {
+		return sources.FetchURL(ctx, feedURL)
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(feedURL, sources.FilePrefix))
+	return data, sources.FetchMeta{URL: feedURL, Bytes: len(data)}, err
+}
+
+//the character encoding of a feed, from the Content-Type header, a BOM or the XML declaration
+func detectEncoding(contentType string, data []byte) string {
+	var found []string
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		found = append(found, params["charset"]+" (Content-Type)")
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		found = append(found, "UTF-8 (BOM)")
+	case bytes.HasPrefix(data, []byte("\xfe\xff")):
+		found = append(found, "UTF-16BE (BOM)")
+	case bytes.HasPrefix(data, []byte("\xff\xfe")):
+		found = append(found, "UTF-16LE (BOM)")
+	}
+	if declared := sources.XMLEncoding(data); declared != "" {
+		found = append(found, declared+" (XML declaration)")
+	}
+	if len(found) == 0 {
+		return "not declared, assuming UTF-8"
+	}
+	return strings.Join(found, ", ")
+}
@@ -0,0 +1,588 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mattn/go-runewidth"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+	"golang.org/x/net/html"
+)
+
+//savePosts notifies this channel with the feed id when it stored new posts
+const postsChannel = "gator_posts"
+
+//the reader reloads at least this often, in case a notification got lost
+const readerPollInterval = 30 * time.Second
+
+const readerHelp = "j/k move  h/l panes  enter read  m read/unread  s star  o open  r refresh  q quit"
+
+type readerPane int
+
+const (
+	paneFeeds readerPane = iota
+	panePosts
+	paneContent
+)
+
+//an entry of the subscriptions pane, All and Starred come before the followed feeds
+type readerFeed struct {
+	name    string
+	feedID  uuid.NullUUID
+	starred bool
+	unread  int64
+}
+
+//the full-screen reader: subscriptions, the posts of the selected one and the selected post
+type reader struct {
+	ctx    context.Context
+	s      *state
+	user   database.User
+	screen tcell.Screen
+	limit  int
+
+	feeds []readerFeed
+	posts []database.GetReaderPostsRow
+	focus readerPane
+	//selected entries and the first visible line of every pane
+	feedCursor, postCursor       int
+	feedTop, postTop, contentTop int
+	//shown instead of the key help until the next key
+	status string
+}
+
+//browse the followed feeds full-screen, updating live while agg stores posts: reader [--limit 200]
+func handlerReader(ctx context.Context, s *state, cmd command, user database.User) error {
+	limit := cmd.intFlag("limit")
+	if limit < 1 {
+		return invalidArgument("the limit must be at least 1")
+	}
+	r := &reader{ctx: ctx, s: s, user: user, limit: limit}
+	if err := r.reload(); err != nil {
+		return err
+	}
+
+	//agg and ingest NOTIFY after storing posts, see savePosts
+	listener := pq.NewListener(s.cfg.DB_url, time.Second, time.Minute, nil)
+	defer listener.Close()
+	if err := listener.Listen(postsChannel); err != nil {
+		r.status = fmt.Sprintf("no live updates: %v", err)
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("could not open the terminal: %w", err)
+	}
+	if err := screen.Init(); err != nil {
+		return fmt.Errorf("could not open the terminal: %w", err)
+	}
+	defer screen.Fini()
+	r.screen = screen
+
+	events := make(chan tcell.Event)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			event := screen.PollEvent()
+			if event == nil {
+				return
+			}
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(readerPollInterval)
+	defer ticker.Stop()
+	for {
+		r.draw()
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			switch event := event.(type) {
+			case *tcell.EventResize:
+				screen.Sync()
+			case *tcell.EventKey:
+				if r.handleKey(event) {
+					return nil
+				}
+			}
+		case <-listener.Notify:
+			//agg with several workers notifies in bursts, one reload covers them all
+			for len(listener.Notify) > 0 {
+				<-listener.Notify
+			}
+			r.refresh()
+		case <-ticker.C:
+			r.refresh()
+		}
+	}
+}
+
+//load the subscriptions with their unread counts and the posts of the selected one
+func (r *reader) reload() error {
+	follows, err := r.s.db.GetFeedFollowsForUser(r.ctx, r.user.ID)
+	if err != nil {
+		return dbError(err, "could not fetch feeds")
+	}
+	counts, err := r.s.db.CountUnreadPosts(r.ctx, r.user.ID)
+	if err != nil {
+		return dbError(err, "could not count unread posts")
+	}
+	unread := map[uuid.UUID]int64{}
+	var total int64
+	for _, count := range counts {
+		unread[count.FeedID] = count.Unread
+		total += count.Unread
+	}
+	feeds := []readerFeed{{name: "All", unread: total}, {name: "Starred", starred: true}}
+	for _, follow := range follows {
+		feeds = append(feeds, readerFeed{
+			name:   follow.FeedName,
+			feedID: uuid.NullUUID{UUID: follow.FeedID, Valid: true},
+			unread: unread[follow.FeedID],
+		})
+	}
+	r.feeds = feeds
+	r.feedCursor = clamp(r.feedCursor, len(r.feeds))
+	return r.loadPosts()
+}
+
+//load the posts of the selected subscription, keeping the selected post if it is still there
+func (r *reader) loadPosts() error {
+	feed := r.feeds[r.feedCursor]
+	posts, err := r.s.db.GetReaderPosts(r.ctx, database.GetReaderPostsParams{
+		UserID:      r.user.ID,
+		FeedID:      feed.feedID,
+		StarredOnly: feed.starred,
+		Limit:       int32(r.limit),
+	})
+	if err != nil {
+		return dbError(err, "could not fetch posts")
+	}
+	var selected uuid.UUID
+	if post, ok := r.current(); ok {
+		selected = post.ID
+	}
+	r.posts = posts
+	r.postCursor = clamp(r.postCursor, len(r.posts))
+	for i, post := range r.posts {
+		if post.ID == selected {
+			r.postCursor = i
+		}
+	}
+	return nil
+}
+
+//reload after new posts came in, saying how many appeared in the list
+func (r *reader) refresh() {
+	known := map[uuid.UUID]bool{}
+	for _, post := range r.posts {
+		known[post.ID] = true
+	}
+	if err := r.reload(); err != nil {
+		r.status = err.Error()
+		return
+	}
+	added := 0
+	for _, post := range r.posts {
+		if !known[post.ID] {
+			added++
+		}
+	}
+	if added > 0 {
+		r.status = fmt.Sprintf("%v new posts", added)
+	}
+}
+
+func (r *reader) current() (database.GetReaderPostsRow, bool) {
+	if r.postCursor >= len(r.posts) {
+		return database.GetReaderPostsRow{}, false
+	}
+	return r.posts[r.postCursor], true
+}
+
+//handle a key press, returns true to quit
+func (r *reader) handleKey(event *tcell.EventKey) bool {
+	r.status = ""
+	_, height := r.screen.Size()
+	page := max(1, (height-2)/2)
+	switch {
+	case event.Key() == tcell.KeyCtrlC || event.Rune() == 'q':
+		return true
+	case event.Key() == tcell.KeyDown || event.Rune() == 'j':
+		r.move(1)
+	case event.Key() == tcell.KeyUp || event.Rune() == 'k':
+		r.move(-1)
+	case event.Key() == tcell.KeyCtrlD || event.Key() == tcell.KeyPgDn:
+		r.move(page)
+	case event.Key() == tcell.KeyCtrlU || event.Key() == tcell.KeyPgUp:
+		r.move(-page)
+	case event.Key() == tcell.KeyHome || event.Rune() == 'g':
+		r.move(-1 << 30)
+	case event.Key() == tcell.KeyEnd || event.Rune() == 'G':
+		r.move(1 << 30)
+	case event.Rune() == ' ':
+		//page through the post from any pane
+		r.contentTop += page
+	case event.Key() == tcell.KeyLeft || event.Rune() == 'h':
+		if r.focus > paneFeeds {
+			r.focus--
+		}
+	case event.Key() == tcell.KeyRight || event.Key() == tcell.KeyEnter || event.Rune() == 'l':
+		if r.focus < paneContent {
+			r.focus++
+		}
+		if r.focus == paneContent {
+			r.setRead(true)
+		}
+	case event.Key() == tcell.KeyTab:
+		r.focus = (r.focus + 1) % (paneContent + 1)
+	case event.Rune() == 'm':
+		if post, ok := r.current(); ok {
+			r.setRead(!post.Read)
+		}
+	case event.Rune() == 's':
+		r.toggleStar()
+	case event.Rune() == 'o':
+		if post, ok := r.current(); ok {
+			if err := openBrowser(post.Url); err != nil {
+				r.status = err.Error()
+			} else {
+				r.setRead(true)
+			}
+		}
+	case event.Rune() == 'r':
+		r.refresh()
+		if r.status == "" {
+			r.status = "Up to date"
+		}
+	case event.Rune() == '?':
+		r.status = readerHelp
+	}
+	return false
+}
+
+//move the cursor of the focused pane, or scroll the post
+func (r *reader) move(delta int) {
+	switch r.focus {
+	case paneFeeds:
+		cursor := clamp(r.feedCursor+delta, len(r.feeds))
+		if cursor != r.feedCursor {
+			r.feedCursor = cursor
+			r.posts = nil
+			r.postCursor, r.postTop, r.contentTop = 0, 0, 0
+			if err := r.loadPosts(); err != nil {
+				r.status = err.Error()
+			}
+		}
+	case panePosts:
+		cursor := clamp(r.postCursor+delta, len(r.posts))
+		if cursor != r.postCursor {
+			r.postCursor = cursor
+			r.contentTop = 0
+		}
+	case paneContent:
+		r.contentTop = max(0, r.contentTop+delta)
+	}
+}
+
+//mark the selected post read or unread and update the counts
+func (r *reader) setRead(read bool) {
+	post, ok := r.current()
+	if !ok || post.Read == read {
+		return
+	}
+	var err error
+	if read {
+		err = r.s.db.MarkPostsRead(r.ctx, database.MarkPostsReadParams{UserID: r.user.ID, PostIds: []uuid.UUID{post.ID}})
+	} else {
+		err = r.s.db.MarkPostUnread(r.ctx, database.MarkPostUnreadParams{UserID: r.user.ID, PostID: post.ID})
+	}
+	if err == nil {
+		err = r.reload()
+	}
+	if err != nil {
+		r.status = err.Error()
+	}
+}
+
+func (r *reader) toggleStar() {
+	post, ok := r.current()
+	if !ok {
+		return
+	}
+	var err error
+	if post.Starred {
+		err = r.s.db.UnstarPost(r.ctx, database.UnstarPostParams{UserID: r.user.ID, PostID: post.ID})
+	} else {
+		err = r.s.db.StarPost(r.ctx, database.StarPostParams{UserID: r.user.ID, PostID: post.ID})
+	}
+	if err == nil {
+		err = r.reload()
+	}
+	if err != nil {
+		r.status = err.Error()
+	}
+}
+
+//draw the title bar, the three panes and the status line
+func (r *reader) draw() {
+	r.screen.Clear()
+	width, height := r.screen.Size()
+	if width < 20 || height < 4 {
+		r.screen.Show()
+		return
+	}
+	bar := tcell.StyleDefault.Reverse(true)
+	fillRow(r.screen, 0, 0, width, bar)
+	drawText(r.screen, 0, 0, width, bar, " gator reader - "+r.user.Name)
+	rows := height - 2
+
+	feedsWidth := min(28, width/4)
+	postsWidth := (width - feedsWidth) * 2 / 5
+	contentX := feedsWidth + postsWidth + 2
+	for y := 1; y <= rows; y++ {
+		r.screen.SetContent(feedsWidth, y, tcell.RuneVLine, nil, tcell.StyleDefault)
+		r.screen.SetContent(feedsWidth+1+postsWidth, y, tcell.RuneVLine, nil, tcell.StyleDefault)
+	}
+
+	r.feedTop = scrollTo(r.feedCursor, r.feedTop, rows)
+	for i := r.feedTop; i < len(r.feeds) && i-r.feedTop < rows; i++ {
+		feed := r.feeds[i]
+		style := r.itemStyle(paneFeeds, i == r.feedCursor).Bold(feed.unread > 0)
+		label := feed.name
+		if feed.unread > 0 {
+			label = fmt.Sprintf("%v (%v)", feed.name, feed.unread)
+		}
+		y := 1 + i - r.feedTop
+		fillRow(r.screen, 0, y, feedsWidth, style)
+		drawText(r.screen, 0, y, feedsWidth, style, " "+label)
+	}
+
+	r.postTop = scrollTo(r.postCursor, r.postTop, rows)
+	if len(r.posts) == 0 {
+		drawText(r.screen, feedsWidth+1, 1, postsWidth, tcell.StyleDefault.Dim(true), " No posts")
+	}
+	for i := r.postTop; i < len(r.posts) && i-r.postTop < rows; i++ {
+		post := r.posts[i]
+		style := r.itemStyle(panePosts, i == r.postCursor).Bold(!post.Read)
+		mark := " "
+		if post.Starred {
+			mark = "*"
+		}
+		date := "      "
+		if post.PublishedAt.Valid {
+			date = post.PublishedAt.Time.Format("Jan 02")
+		}
+		y := 1 + i - r.postTop
+		fillRow(r.screen, feedsWidth+1, y, postsWidth, style)
+		drawText(r.screen, feedsWidth+1, y, postsWidth, style, fmt.Sprintf("%v%v %v", mark, date, post.Title.String))
+	}
+
+	if post, ok := r.current(); ok {
+		lines := r.render(post, width-contentX-1)
+		r.contentTop = min(r.contentTop, max(0, len(lines)-rows))
+		for i := r.contentTop; i < len(lines) && i-r.contentTop < rows; i++ {
+			style := tcell.StyleDefault
+			if i == 0 {
+				style = style.Bold(true)
+			}
+			drawText(r.screen, contentX, 1+i-r.contentTop, width-contentX, style, lines[i])
+		}
+	}
+
+	status := r.status
+	if status == "" {
+		status = readerHelp
+	}
+	fillRow(r.screen, 0, height-1, width, bar)
+	drawText(r.screen, 0, height-1, width, bar, " "+status)
+	r.screen.Show()
+}
+
+//the selected entry is reversed in the focused pane and underlined elsewhere
+func (r *reader) itemStyle(pane readerPane, selected bool) tcell.Style {
+	style := tcell.StyleDefault
+	if selected && r.focus == pane {
+		return style.Reverse(true)
+	}
+	if selected {
+		return style.Underline(true)
+	}
+	return style
+}
+
+//the lines of the content pane: title, feed, date, URL and the text of the post
+func (r *reader) render(post database.GetReaderPostsRow, width int) []string {
+	var lines []string
+	lines = append(lines, wrapText(post.Title.String, width)...)
+	meta := post.FeedName
+	if post.PublishedAt.Valid {
+		meta += ", " + post.PublishedAt.Time.Format("2006-01-02 15:04")
+	}
+	if post.Starred {
+		meta += ", starred"
+	}
+	lines = append(lines, wrapText(meta, width)...)
+	lines = append(lines, wrapText(post.Url, width)...)
+	lines = append(lines, "")
+	//the full text when the feed carried one besides the description
+	text := post.Description.String
+	if post.Content.Valid {
+		text = post.Content.String
+	}
+	lines = append(lines, wrapText(htmlToText(text), width)...)
+	return lines
+}
+
+//the first visible line so that cursor is on screen
+func scrollTo(cursor, top, rows int) int {
+	if cursor < top {
+		return cursor
+	}
+	if cursor >= top+rows {
+		return cursor - rows + 1
+	}
+	return top
+}
+
+//keep a cursor within a list of n entries
+func clamp(cursor, n int) int {
+	return max(0, min(cursor, n-1))
+}
+
+func fillRow(screen tcell.Screen, x, y, width int, style tcell.Style) {
+	for i := 0; i < width; i++ {
+		screen.SetContent(x+i, y, ' ', nil, style)
+	}
+}
+
+//print text at x, y, cut off at width cells
+func drawText(screen tcell.Screen, x, y, width int, style tcell.Style, text string) {
+	used := 0
+	for _, r := range text {
+		w := runewidth.RuneWidth(r)
+		if w == 0 {
+			continue
+		}
+		if used+w > width {
+			return
+		}
+		screen.SetContent(x+used, y, r, nil, style)
+		used += w
+	}
+}
+
+//break text into lines of at most width cells, at spaces where possible
+func wrapText(text string, width int) []string {
+	if width < 1 {
+		return nil
+	}
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line, lineWidth := "", 0
+		for _, word := range strings.Fields(paragraph) {
+			wordWidth := runewidth.StringWidth(word)
+			if lineWidth > 0 && lineWidth+1+wordWidth > width {
+				lines = append(lines, line)
+				line, lineWidth = "", 0
+			}
+			//words longer than a line are cut
+			for wordWidth > width {
+				head := runewidth.Truncate(word, width, "")
+				lines = append(lines, head)
+				word = word[len(head):]
+				wordWidth = runewidth.StringWidth(word)
+			}
+			if lineWidth > 0 {
+				line += " "
+				lineWidth++
+			}
+			line += word
+			lineWidth += wordWidth
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+var (
+	spaces     = regexp.MustCompile(`\s+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+//elements that start a new paragraph
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "blockquote": true, "pre": true,
+	"ul": true, "ol": true, "table": true, "tr": true, "figure": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+//the readable text of an HTML description, with paragraphs, list items and link targets
+func htmlToText(source string) string {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return source
+	}
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			//whitespace only separates words, like in a browser
+			sb.WriteString(spaces.ReplaceAllString(n.Data, " "))
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style":
+				return
+			case "br":
+				sb.WriteString("\n")
+			case "li":
+				sb.WriteString("\n- ")
+			case "img":
+				for _, a := range n.Attr {
+					if a.Key == "alt" && a.Val != "" {
+						sb.WriteString("[image: " + a.Val + "]")
+					}
+				}
+			}
+			if blockElements[n.Data] {
+				sb.WriteString("\n\n")
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if n.Type == html.ElementNode {
+			if blockElements[n.Data] {
+				sb.WriteString("\n\n")
+			}
+			if n.Data == "a" {
+				for _, a := range n.Attr {
+					if a.Key == "href" && strings.HasPrefix(a.Val, "http") {
+						sb.WriteString(" <" + a.Val + ">")
+					}
+				}
+			}
+		}
+	}
+	walk(doc)
+	lines := strings.Split(sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
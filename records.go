@@ -0,0 +1,193 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+	"github.com/max-durnea/blog-aggregator/internal/sources"
+)
+
+//what commands print with --output json, jsonl, csv or table. The json tags are the
+//documented field names, keep them stable: scripts depend on them
+
+//users, login and register
+type userRecord struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+func newUserRecord(user database.User, current string) userRecord {
+	return userRecord{ID: user.ID, Name: user.Name, CreatedAt: user.CreatedAt, Current: user.Name == current}
+}
+
+//feeds and addfeed
+type feedRecord struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Type          string     `json:"type"`
+	AddedBy       string     `json:"added_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+}
+
+func newFeedRecord(feed database.Feed, addedBy string) feedRecord {
+	return feedRecord{
+		ID:            feed.ID,
+		Name:          feed.Name,
+		URL:           feed.Url,
+		Type:          feed.FeedType,
+		AddedBy:       addedBy,
+		CreatedAt:     feed.CreatedAt,
+		LastFetchedAt: nullTime(feed.LastFetchedAt.Valid, feed.LastFetchedAt.Time),
+	}
+}
+
+//following and follow
+type followRecord struct {
+	FeedID     uuid.UUID `json:"feed_id"`
+	FeedName   string    `json:"feed_name"`
+	FeedURL    string    `json:"feed_url"`
+	User       string    `json:"user"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+//browse
+type postRecord struct {
+	ID           uuid.UUID  `json:"id"`
+	Title        string     `json:"title"`
+	URL          string     `json:"url"`
+	Description  string     `json:"description"`
+	PublishedAt  *time.Time `json:"published_at"`
+	FeedID       uuid.UUID  `json:"feed_id"`
+	EnclosureURL *string    `json:"enclosure_url"`
+	//pass to browse --before for the posts after this one, or --after for those before it
+	Cursor string `json:"cursor"`
+}
+
+func newPostRecord(post database.GetPostsForUserRow) postRecord {
+	record := postRecord{
+		ID:          post.ID,
+		Title:       post.Title.String,
+		URL:         post.Url,
+		Description: post.Description.String,
+		PublishedAt: nullTime(post.PublishedAt.Valid, post.PublishedAt.Time),
+		FeedID:      post.FeedID,
+		Cursor:      cursorOf(post).String(),
+	}
+	if post.EnclosureUrl.Valid {
+		record.EnclosureURL = &post.EnclosureUrl.String
+	}
+	return record
+}
+
+//search
+type searchRecord struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	Feed        string     `json:"feed"`
+	PublishedAt *time.Time `json:"published_at"`
+	Rank        float32    `json:"rank"`
+	//the best matching passages with the matches highlighted
+	Snippet string `json:"snippet"`
+	//the title with the matches highlighted, for the text format
+	titleHeadline string
+}
+
+func newSearchRecord(row database.SearchPostsRow) searchRecord {
+	return searchRecord{
+		ID:            row.ID,
+		Title:         row.Title.String,
+		URL:           row.Url,
+		Feed:          row.FeedName,
+		PublishedAt:   nullTime(row.PublishedAt.Valid, row.PublishedAt.Time),
+		Rank:          row.Rank,
+		Snippet:       row.Snippet,
+		titleHeadline: row.TitleHeadline,
+	}
+}
+
+//fetchlog
+type fetchAttemptRecord struct {
+	Feed          string    `json:"feed"`
+	StartedAt     time.Time `json:"started_at"`
+	HTTPStatus    *int32    `json:"http_status"`
+	DurationMs    int32     `json:"duration_ms"`
+	Bytes         int32     `json:"bytes"`
+	ItemsParsed   int32     `json:"items_parsed"`
+	PostsInserted int32     `json:"posts_inserted"`
+	PostsUpdated  int32     `json:"posts_updated"`
+	Duplicates    int32     `json:"duplicates"`
+	Error         *string   `json:"error"`
+}
+
+func newFetchAttemptRecord(attempt database.GetFetchAttemptsRow) fetchAttemptRecord {
+	record := fetchAttemptRecord{
+		Feed:          attempt.FeedName,
+		StartedAt:     attempt.StartedAt,
+		DurationMs:    attempt.DurationMs,
+		Bytes:         attempt.Bytes,
+		ItemsParsed:   attempt.ItemsParsed,
+		PostsInserted: attempt.PostsInserted,
+		PostsUpdated:  attempt.PostsUpdated,
+		Duplicates:    attempt.Duplicates,
+	}
+	if attempt.HttpStatus.Valid {
+		record.HTTPStatus = &attempt.HttpStatus.Int32
+	}
+	if attempt.Error.Valid {
+		record.Error = &attempt.Error.String
+	}
+	return record
+}
+
+//ingest
+type ingestRecord struct {
+	Feed       string `json:"feed"`
+	FeedURL    string `json:"feed_url"`
+	Items      int    `json:"items"`
+	Inserted   int    `json:"inserted"`
+	Updated    int    `json:"updated"`
+	Duplicates int    `json:"duplicates"`
+}
+
+//validate
+type issueRecord struct {
+	Severity string `json:"severity"`
+	//1-based position of the item, 0 for the feed itself
+	Item    int    `json:"item"`
+	Message string `json:"message"`
+}
+
+func newIssueRecord(issue sources.Issue) issueRecord {
+	return issueRecord{Severity: issue.Severity, Item: issue.Item, Message: issue.Message}
+}
+
+//preview
+type previewRecord struct {
+	URL        string `json:"url"`
+	HTTPStatus *int   `json:"http_status"`
+	Bytes      int    `json:"bytes"`
+	DurationMs int64  `json:"duration_ms"`
+	Encoding   string `json:"encoding"`
+	//the headers of cacheHeaders the server sent
+	CacheHeaders     map[string]string   `json:"cache_headers"`
+	Format           string              `json:"format"`
+	Title            string              `json:"title"`
+	Link             string              `json:"link"`
+	Hub              string              `json:"hub"`
+	Items            int                 `json:"items"`
+	MissingDates     int                 `json:"missing_dates"`
+	UnparseableDates []string            `json:"unparseable_dates"`
+	Latest           []previewItemRecord `json:"latest"`
+}
+
+type previewItemRecord struct {
+	Title       string     `json:"title"`
+	Link        string     `json:"link"`
+	PublishedAt *time.Time `json:"published_at"`
+}
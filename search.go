@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+	"golang.org/x/term"
+)
+
+//the text search configuration the search column of posts is built with, see 015_post_search.sql
+const searchIndexLanguage = "english"
+
+//how ts_headline marks the matches: bold for text on a terminal, <mark> tags for everything else
+func highlightMarkers(format outputFormat) (string, string) {
+	if format == outputText && term.IsTerminal(int(os.Stdout.Fd())) {
+		return "\x1b[1m", "\x1b[0m"
+	}
+	return "<mark>", "</mark>"
+}
+
+//full-text search over the posts of the followed feeds, or of every feed with --all:
+//search <query>... [--all] [--language english] [--limit 10]
+func handlerSearch(ctx context.Context, s *state, cmd command, user database.User) error {
+	limit := cmd.intFlag("limit")
+	if limit < 1 {
+		return invalidArgument("the limit must be at least 1")
+	}
+	query := strings.Join(cmd.args, " ")
+	language := strings.ToLower(firstNonEmpty(cmd.stringFlag("language"), s.cfg.SearchLanguage, searchIndexLanguage))
+	start, stop := highlightMarkers(s.out.format)
+	params := database.SearchPostsParams{
+		Query:          query,
+		TitleOptions:   fmt.Sprintf(`StartSel="%v", StopSel="%v", HighlightAll=true`, start, stop),
+		SnippetOptions: fmt.Sprintf(`StartSel="%v", StopSel="%v", MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=" … "`, start, stop),
+		All:            cmd.boolFlag("all"),
+		UserID:         user.ID,
+		Limit:          int32(limit),
+	}
+
+	var rows []database.SearchPostsRow
+	var err error
+	if language == searchIndexLanguage {
+		rows, err = s.db.SearchPosts(ctx, params)
+	} else {
+		var found []database.SearchPostsInLanguageRow
+		found, err = s.db.SearchPostsInLanguage(ctx, database.SearchPostsInLanguageParams{
+			Language:       language,
+			Query:          params.Query,
+			TitleOptions:   params.TitleOptions,
+			SnippetOptions: params.SnippetOptions,
+			All:            params.All,
+			UserID:         params.UserID,
+			Limit:          params.Limit,
+		})
+		for _, row := range found {
+			rows = append(rows, database.SearchPostsRow(row))
+		}
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "42704" {
+		return invalidArgument("unknown text search configuration %q, psql lists them with \\dF", language)
+	}
+	if err != nil {
+		return dbError(err, "could not search posts")
+	}
+
+	records := make([]searchRecord, 0, len(rows))
+	posts := make([]postRecord, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, newSearchRecord(row))
+		posts = append(posts, newPostRecord(database.GetPostsForUserRow{
+			ID:          row.ID,
+			Title:       row.Title,
+			Url:         row.Url,
+			Description: row.Description,
+			PublishedAt: row.PublishedAt,
+			FeedID:      row.FeedID,
+		}))
+	}
+	if s.session != nil {
+		s.session.posts = posts
+	}
+	if len(records) == 0 {
+		s.out.message("No posts match %q.", query)
+	}
+	marker := postMarkers(s)
+	return writeList(s.out, records, func(w io.Writer, result searchRecord) {
+		snippet := strings.Join(strings.Fields(result.Snippet), " ")
+		fmt.Fprintf(w, "%v %v (%v)\n - %v\n = %v\n\n", marker(), result.titleHeadline, result.Feed, snippet, result.URL)
+	})
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+//what the shell remembers between commands
+type shellSession struct {
+	//the posts of the last browse or search, numbered from 1
+	posts []postRecord
+	//receives once a cancelled command that did not stop in time returns, nil when none is left
+	abandoned <-chan error
+}
+
+//whether a command given up on is still running and holding on to the state
+func (session *shellSession) busy() bool {
+	if session.abandoned == nil {
+		return false
+	}
+	select {
+	case <-session.abandoned:
+		session.abandoned = nil
+		return false
+	default:
+		return true
+	}
+}
+
+//the post behind a number from the last listing
+func (session *shellSession) post(arg string) (postRecord, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		return postRecord{}, invalidArgument("%q is not a post number", arg)
+	}
+	if len(session.posts) == 0 {
+		return postRecord{}, invalidArgument("no posts listed yet, run browse or search first")
+	}
+	if n < 1 || n > len(session.posts) {
+		return postRecord{}, invalidArgument("no post %v, the last listing has 1 to %v", n, len(session.posts))
+	}
+	return session.posts[n-1], nil
+}
+
+//the bullets of the posts in a text list: "*", or in the shell the number that commands
+//like open 2 refer to the post by
+func postMarkers(s *state) func() string {
+	number := 0
+	return func() string {
+		number++
+		if s.session == nil {
+			return "*"
+		}
+		return fmt.Sprintf("%v.", number)
+	}
+}
+
+//an interactive prompt that keeps one state and connection: shell
+func (c *commands) handlerShell(ctx context.Context, s *state, cmd command) error {
+	if s.session != nil {
+		return invalidArgument("already in the shell")
+	}
+	s.session = &shellSession{}
+	defer func() { s.session = nil }()
+
+	readLine, err := c.lineReader(ctx, s)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Type help for the commands, open <n> or show <n> for a post of the last browse or search, #<n> for its URL, exit to leave.")
+	for ctx.Err() == nil {
+		line, err := readLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		words, err := splitLine(line)
+		if err != nil {
+			commandFailed(kindInvalidArgument, err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "exit" || words[0] == "quit" {
+			return nil
+		}
+		c.runInShell(ctx, s, words)
+	}
+	return nil
+}
+
+//run one line of the shell, Ctrl-C cancels it without leaving the shell
+func (c *commands) runInShell(ctx context.Context, s *state, words []string) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	if s.session.busy() {
+		err := conflict("the cancelled command is still running, try again once it returns")
+		commandFailed(kindOf(err), err)
+		return
+	}
+	var err error
+	switch words[0] {
+	case "open":
+		err = s.session.open(words[1:])
+	case "show":
+		err = s.session.show(s.out, words[1:])
+	default:
+		//#2 stands for the URL of post 2
+		for i, word := range words[1:] {
+			if len(word) > 1 && word[0] == '#' {
+				post, err := s.session.post(word)
+				if err != nil {
+					commandFailed(kindOf(err), err)
+					return
+				}
+				words[i+1] = post.URL
+			}
+		}
+		c.run(ctx, s, command{name: words[0], args: words[1:]})
+		return
+	}
+	if err != nil {
+		commandFailed(kindOf(err), err)
+	}
+}
+
+//open <n>: open a post of the last listing in the browser
+func (session *shellSession) open(args []string) error {
+	if len(args) != 1 {
+		return invalidArgument("usage: open <n>")
+	}
+	post, err := session.post(args[0])
+	if err != nil {
+		return err
+	}
+	return openBrowser(post.URL)
+}
+
+//show <n>: print a post of the last listing in full
+func (session *shellSession) show(out *output, args []string) error {
+	if len(args) != 1 {
+		return invalidArgument("usage: show <n>")
+	}
+	post, err := session.post(args[0])
+	if err != nil {
+		return err
+	}
+	return writeRecord(out, post, func(w io.Writer, post postRecord) {
+		fmt.Fprintf(w, "%v\n%v\n", post.Title, post.URL)
+		if post.PublishedAt != nil {
+			fmt.Fprintf(w, "Published %v\n", post.PublishedAt.Format("2006-01-02 15:04"))
+		}
+		fmt.Fprintf(w, "\n%v\n", post.Description)
+	})
+}
+
+//open a URL with the desktop's default handler
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not open %v: %w", url, err)
+	}
+	go cmd.Wait()
+	return nil
+}
+
+//read lines with editing, history and tab completion on a terminal, plain lines otherwise.
+//The terminal is only in raw mode while a line is read, so commands print as usual
+func (c *commands) lineReader(ctx context.Context, s *state) (func() (string, error), error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		return func() (string, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return scanner.Text(), nil
+		}, nil
+	}
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "gator> ")
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return c.completeLine(ctx, s, line, pos)
+	}
+	readLine := func() (string, error) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(fd, oldState)
+		if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+			terminal.SetSize(width, height)
+		}
+		//Ctrl-C and Ctrl-D both come back as io.EOF
+		return terminal.ReadLine()
+	}
+	return readLine, nil
+}
+
+//complete the word before the cursor, as far as all candidates agree
+func (c *commands) completeLine(ctx context.Context, s *state, line string, pos int) (string, int, bool) {
+	//a quote may still be open in the word being completed
+	words, start, quote := scanLine(line[:pos])
+	if start < 0 {
+		words = append(words, "")
+		start = pos
+	}
+	candidates := c.complete(ctx, s, words)
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	current := words[len(words)-1]
+	completion := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(completion) <= len(current) && len(candidates) > 1 {
+		return "", 0, false
+	}
+	//the word is written again quoted, so a name with blanks stays one argument
+	var word string
+	switch {
+	case len(candidates) == 1:
+		word = shellQuote(completion) + " "
+	case quote != 0 || shellQuote(completion) != completion:
+		//leave the quote open, the next completion picks it up
+		word = "'" + strings.ReplaceAll(completion, "'", `'\''`)
+	default:
+		word = completion
+	}
+	return line[:start] + word + line[pos:], start + len(word), true
+}
+
+//a word quoted so that splitLine and POSIX shells read it back as one, left alone when it
+//has nothing they would treat specially
+func shellQuote(word string) string {
+	special := strings.IndexFunc(word, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("-_./:=@%+,", r))
+	})
+	if word != "" && special < 0 {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+//split a line into words like a shell would, with "double" or 'single' quotes and \ escapes
+func splitLine(line string) ([]string, error) {
+	words, _, quote := scanLine(line)
+	if quote != 0 {
+		return nil, invalidArgument("unterminated %c quote", quote)
+	}
+	return words, nil
+}
+
+//the words of a line, the byte offset the last word starts at or -1 when the line ends
+//between words, and the quote left open at the end of the line, if any
+func scanLine(line string) ([]string, int, rune) {
+	var words []string
+	var word strings.Builder
+	start := -1
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		if start < 0 && !(quote == 0 && !escaped && (r == ' ' || r == '\t')) {
+			start = i
+		}
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			if start >= 0 {
+				words = append(words, word.String())
+				word.Reset()
+				start = -1
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+	if start >= 0 {
+		words = append(words, word.String())
+	}
+	return words, start, quote
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"blanks only", " \t ", nil, false},
+		{"words", "browse  --limit\t5", []string{"browse", "--limit", "5"}, false},
+		{"double quotes", `search "go generics"`, []string{"search", "go generics"}, false},
+		{"single quotes keep backslashes", `search 'a\b'`, []string{"search", `a\b`}, false},
+		{"escape in double quotes", `search "say \"hi\""`, []string{"search", `say "hi"`}, false},
+		{"escaped blank", `addfeed my\ blog`, []string{"addfeed", "my blog"}, false},
+		{"empty quoted word", `search ""`, []string{"search", ""}, false},
+		{"quotes join a word", `a"b c"d`, []string{"ab cd"}, false},
+		{"unterminated quote", `search "go`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitLine(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"go-blog", "go-blog"},
+		{"https://example.com/feed.xml?a=1", `'https://example.com/feed.xml?a=1'`},
+		{"24h0m0s", "24h0m0s"},
+		{"", "''"},
+		{"Rust Weekly", `'Rust Weekly'`},
+		{"it's", `'it'\''s'`},
+		{`^go\b`, `'^go\b'`},
+	}
+	for _, tt := range tests {
+		got := shellQuote(tt.word)
+		if got != tt.want {
+			t.Errorf("shellQuote(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+		//the shell reads it back as the same single word
+		if words, err := splitLine(got); err != nil || len(words) != 1 || words[0] != tt.word {
+			t.Errorf("splitLine(%q) = %q, %v, want [%q]", got, words, err, tt.word)
+		}
+	}
+}
+
+func TestCompleteLine(t *testing.T) {
+	c := newCommands()
+	c.register(commandSpec{
+		name:  "browse",
+		flags: []flagSpec{{name: "feed", value: []string(nil), complete: choices("go-blog", "Rust Weekly", "Rust Web", "it's")}},
+	})
+	tests := []struct {
+		name    string
+		line    string
+		pos     int
+		want    string
+		wantPos int
+		//the word the completed candidate reads back as, "" while the completion is partial
+		word string
+	}{
+		{"command", "bro", 3, "browse ", 7, "browse"},
+		{"plain value", "browse --feed go", 16, "browse --feed go-blog ", 22, "go-blog"},
+		{"common prefix with a blank leaves the quote open", "browse --feed Ru", 16, "browse --feed 'Rust We", 22, ""},
+		{"open quote", "browse --feed 'Rust Wee", 23, "browse --feed 'Rust Weekly' ", 28, "Rust Weekly"},
+		{"escaped blank", `browse --feed Rust\ Wee`, 23, "browse --feed 'Rust Weekly' ", 28, "Rust Weekly"},
+		{"quote in the value", "browse --feed it", 16, `browse --feed 'it'\''s' `, 24, "it's"},
+		{"text after the cursor stays", "browse --feed go --unread", 16, "browse --feed go-blog  --unread", 22, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotPos, ok := c.completeLine(context.Background(), nil, tt.line, tt.pos)
+			if !ok || got != tt.want || gotPos != tt.wantPos {
+				t.Fatalf("completeLine(%q) = %q, %v, %v, want %q, %v", tt.line, got, gotPos, ok, tt.want, tt.wantPos)
+			}
+			if tt.word == "" {
+				return
+			}
+			if words, err := splitLine(got); err != nil || words[len(words)-1] != tt.word {
+				t.Errorf("completed line %q splits into %q, %v, want the last word %q", got, words, err, tt.word)
+			}
+		})
+	}
+	for _, line := range []string{"browse --feed Rust\\ We", "browse --feed x"} {
+		if got, _, ok := c.completeLine(context.Background(), nil, line, len(line)); ok {
+			t.Errorf("completeLine(%q) = %q, want nothing to complete", line, got)
+		}
+	}
+}
@@ -1,31 +1,59 @@
--- name: CreateFeed :one
-INSERT INTO feeds(id, created_at, updated_at, name, url, user_id)
-VALUES (
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6
-)
-RETURNING *;
-
--- name: GetFeeds :many
-SELECT * FROM feeds;
-
--- name: GetFeedByUrl :one
-SELECT * FROM feeds WHERE url = $1;
-
--- name: MarkFeedFetched :exec
-UPDATE feeds
-SET last_fetched_at = NOW(),
-    updated_at = NOW()
-WHERE id = $1;
-
--- name: GetNextFeedToFetch :one
-SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST 
-LIMIT 1;
-
--- name: ResetFeeds :exec
-DELETE FROM feeds;
\ No newline at end of file
+-- name: CreateFeed :one
+INSERT INTO feeds(id, created_at, updated_at, name, url, user_id, feed_type, config)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING *;
+
+-- name: GetFeeds :many
+SELECT * FROM feeds;
+
+-- name: GetFeedByUrl :one
+SELECT * FROM feeds WHERE url = $1;
+
+-- name: MarkFeedFetched :exec
+UPDATE feeds
+SET last_fetched_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: ReleaseFeed :exec
+UPDATE feeds
+SET last_fetched_at = $2
+WHERE id = $1;
+
+-- name: ClaimNextFeed :one
+WITH next AS (
+    SELECT f.id, f.last_fetched_at FROM feeds f
+    LEFT JOIN websub_subscriptions w ON w.feed_id = f.id AND w.lease_expires_at > NOW()
+    --feeds a hub pushes to are only left out while we run a callback server to receive them
+    WHERE NOT @skip_pushed::boolean OR w.id IS NULL
+    ORDER BY f.last_fetched_at ASC NULLS FIRST
+    LIMIT 1
+    --concurrent workers each claim a different feed
+    FOR UPDATE OF f SKIP LOCKED
+)
+UPDATE feeds
+SET last_fetched_at = NOW(),
+    updated_at = NOW()
+FROM next
+WHERE feeds.id = next.id
+RETURNING feeds.*, next.last_fetched_at AS previous_fetched_at;
+
+-- name: ResetFeeds :exec
+DELETE FROM feeds;
+
+-- name: GetFeedsByName :many
+SELECT * FROM feeds WHERE name = $1;
+
+-- name: GetPollableFeeds :many
+SELECT f.id, f.created_at, f.last_fetched_at FROM feeds f
+LEFT JOIN websub_subscriptions w ON w.feed_id = f.id AND w.lease_expires_at > NOW()
+WHERE NOT @skip_pushed::boolean OR w.id IS NULL;
@@ -24,13 +24,14 @@ SELECT
     ff.user_id,
     u.name AS user_name,
     ff.feed_id,
-    f.name AS feed_name
+    f.name AS feed_name,
+    f.url AS feed_url
 FROM feed_follows ff
 JOIN users u ON ff.user_id = u.id
 JOIN feeds f ON ff.feed_id = f.id
 WHERE ff.user_id = $1;
 
--- name: DeleteFeedFollow :exec
+-- name: DeleteFeedFollow :execrows
 
 DELETE FROM feed_follows ff
 USING users u, feeds f
@@ -0,0 +1,9 @@
+-- name: GetFeedState :one
+SELECT state FROM feed_states WHERE feed_id = $1;
+
+-- name: SaveFeedState :exec
+INSERT INTO feed_states(feed_id, updated_at, state)
+VALUES ($1, NOW(), $2)
+ON CONFLICT (feed_id) DO UPDATE
+SET state = EXCLUDED.state,
+    updated_at = EXCLUDED.updated_at;
@@ -0,0 +1,35 @@
+-- name: CreateFetchAttempt :exec
+INSERT INTO fetch_attempts(id, feed_id, started_at, duration_ms, http_status, bytes, items_parsed, posts_inserted, posts_updated, duplicates, error)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11
+);
+
+-- name: GetFetchAttempts :many
+SELECT fa.*, f.name AS feed_name
+FROM fetch_attempts fa
+JOIN feeds f ON f.id = fa.feed_id
+WHERE (sqlc.narg('feed_id')::uuid IS NULL OR fa.feed_id = sqlc.narg('feed_id'))
+  AND fa.started_at >= sqlc.arg('since')
+ORDER BY fa.started_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: DeleteFetchAttemptsBefore :execrows
+DELETE FROM fetch_attempts WHERE started_at < $1;
+
+-- name: CountErroringFeeds :one
+SELECT COUNT(*) FROM (
+    SELECT DISTINCT ON (feed_id) error
+    FROM fetch_attempts
+    ORDER BY feed_id, started_at DESC
+) latest
+WHERE latest.error IS NOT NULL;
@@ -0,0 +1,21 @@
+-- name: MarkPostsRead :exec
+INSERT INTO post_reads(user_id, post_id, read_at)
+SELECT @user_id::uuid, unnest(@post_ids::uuid[]), NOW()
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :exec
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: ClearPostReads :exec
+--an updated post is news again for everyone who read it
+DELETE FROM post_reads
+WHERE post_id = ANY(@post_ids::uuid[]);
+
+-- name: CountUnreadPosts :many
+SELECT p.feed_id, COUNT(*) AS unread
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1
+  AND NOT EXISTS (SELECT 1 FROM post_reads r WHERE r.user_id = ff.user_id AND r.post_id = p.id)
+GROUP BY p.feed_id;
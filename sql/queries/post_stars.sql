@@ -0,0 +1,8 @@
+-- name: StarPost :exec
+INSERT INTO post_stars(user_id, post_id, starred_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: UnstarPost :exec
+DELETE FROM post_stars
+WHERE user_id = $1 AND post_id = $2;
@@ -1,23 +1,168 @@
--- name: CreatePost :one
-INSERT INTO posts(id,created_at,updated_at,title,url,description,published_at,feed_id)
-VALUES(
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6,
-    $7,
-    $8
-)
-RETURNING *;
-
 -- name: GetPostsForUser :many
-SELECT p.* FROM posts p
+--newest first, past the cursor when there is one. The keyset is (published_at, id) with
+--undated posts as the oldest, written as the expression the browse indexes are built on
+--so an index scan gives the order and starts at the cursor
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, p.enclosure_url
+FROM posts p
+JOIN feed_follows f ON f.feed_id = p.feed_id
+WHERE f.user_id = sqlc.arg('user_id')
+  AND (sqlc.narg('feed_ids')::uuid[] IS NULL OR p.feed_id = ANY(sqlc.narg('feed_ids')::uuid[]))
+  AND (sqlc.narg('since')::timestamp IS NULL OR p.published_at >= sqlc.narg('since'))
+  AND (sqlc.narg('until')::timestamp IS NULL OR p.published_at < sqlc.narg('until'))
+  --case-insensitive substring of the title or description, no LIKE wildcards to escape
+  AND (sqlc.narg('match')::text IS NULL
+      OR strpos(lower(p.title), lower(sqlc.narg('match'))) > 0
+      OR strpos(lower(p.description), lower(sqlc.narg('match'))) > 0)
+  AND (sqlc.narg('regex')::text IS NULL
+      OR p.title ~* sqlc.narg('regex')
+      OR p.description ~* sqlc.narg('regex'))
+  AND (NOT sqlc.arg('has_enclosure')::boolean OR p.enclosure_url IS NOT NULL)
+  AND (NOT sqlc.arg('unread')::boolean OR NOT EXISTS (
+      SELECT 1 FROM post_reads r WHERE r.user_id = f.user_id AND r.post_id = p.id
+  ))
+  AND (sqlc.narg('cursor_id')::uuid IS NULL OR
+      (COALESCE(p.published_at, '-infinity'::timestamp), p.id) <
+      (COALESCE(sqlc.narg('cursor_published')::timestamp, '-infinity'::timestamp), sqlc.narg('cursor_id')::uuid))
+ORDER BY COALESCE(p.published_at, '-infinity'::timestamp) DESC, p.id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: GetPostsForUserAfter :many
+--oldest first from the cursor, for the page of newer posts before it. Takes the same
+--arguments as GetPostsForUser, the cursor is required
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, p.enclosure_url
+FROM posts p
 JOIN feed_follows f ON f.feed_id = p.feed_id
-WHERE f.user_id = $1
-ORDER BY p.published_at DESC
-LIMIT $2;
+WHERE f.user_id = sqlc.arg('user_id')
+  AND (sqlc.narg('feed_ids')::uuid[] IS NULL OR p.feed_id = ANY(sqlc.narg('feed_ids')::uuid[]))
+  AND (sqlc.narg('since')::timestamp IS NULL OR p.published_at >= sqlc.narg('since'))
+  AND (sqlc.narg('until')::timestamp IS NULL OR p.published_at < sqlc.narg('until'))
+  --case-insensitive substring of the title or description, no LIKE wildcards to escape
+  AND (sqlc.narg('match')::text IS NULL
+      OR strpos(lower(p.title), lower(sqlc.narg('match'))) > 0
+      OR strpos(lower(p.description), lower(sqlc.narg('match'))) > 0)
+  AND (sqlc.narg('regex')::text IS NULL
+      OR p.title ~* sqlc.narg('regex')
+      OR p.description ~* sqlc.narg('regex'))
+  AND (NOT sqlc.arg('has_enclosure')::boolean OR p.enclosure_url IS NOT NULL)
+  AND (NOT sqlc.arg('unread')::boolean OR NOT EXISTS (
+      SELECT 1 FROM post_reads r WHERE r.user_id = f.user_id AND r.post_id = p.id
+  ))
+  AND sqlc.narg('cursor_id')::uuid IS NOT NULL
+  AND (COALESCE(p.published_at, '-infinity'::timestamp), p.id) >
+      (COALESCE(sqlc.narg('cursor_published')::timestamp, '-infinity'::timestamp), sqlc.narg('cursor_id')::uuid)
+ORDER BY COALESCE(p.published_at, '-infinity'::timestamp), p.id
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
 
 -- name: ResetPosts :exec
-DELETE FROM posts;
\ No newline at end of file
+DELETE FROM posts;
+
+-- name: InsertPosts :many
+--with update_existing (sources that report changes, like sitemaps) posts that come back
+--with a newer date are refreshed and returned too, otherwise known urls are skipped
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, enclosure_url, content)
+SELECT
+    t.id,
+    NOW(),
+    NOW(),
+    NULLIF(t.title, ''),
+    t.url,
+    NULLIF(t.description, ''),
+    --items without a date come as the zero time
+    NULLIF(t.published_at, '0001-01-01 00:00:00'::timestamp),
+    @feed_id::uuid,
+    NULLIF(t.enclosure_url, ''),
+    NULLIF(t.content, '')
+FROM (
+    --unnest in the select list walks the arrays side by side
+    SELECT
+        unnest(@ids::uuid[]) AS id,
+        unnest(@titles::text[]) AS title,
+        unnest(@urls::text[]) AS url,
+        unnest(@descriptions::text[]) AS description,
+        unnest(@published_ats::timestamp[]) AS published_at,
+        unnest(@enclosure_urls::text[]) AS enclosure_url,
+        unnest(@contents::text[]) AS content
+) AS t
+ON CONFLICT (url) DO UPDATE
+SET title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    published_at = EXCLUDED.published_at,
+    enclosure_url = EXCLUDED.enclosure_url,
+    content = EXCLUDED.content,
+    updated_at = NOW()
+WHERE @update_existing::boolean
+  AND posts.feed_id = EXCLUDED.feed_id
+  --an item without a date is never newer, it would update the post on every fetch
+  AND EXCLUDED.published_at IS NOT NULL
+  AND (posts.published_at IS NULL OR posts.published_at < EXCLUDED.published_at)
+RETURNING id;
+
+-- name: GetReaderPosts :many
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, p.content, f.name AS feed_name,
+    EXISTS (SELECT 1 FROM post_reads r WHERE r.user_id = ff.user_id AND r.post_id = p.id) AS read,
+    EXISTS (SELECT 1 FROM post_stars st WHERE st.user_id = ff.user_id AND st.post_id = p.id) AS starred
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+JOIN feeds f ON f.id = p.feed_id
+WHERE ff.user_id = sqlc.arg('user_id')
+  AND (sqlc.narg('feed_id')::uuid IS NULL OR p.feed_id = sqlc.narg('feed_id'))
+  AND (NOT sqlc.arg('starred_only')::boolean OR EXISTS (
+      SELECT 1 FROM post_stars st WHERE st.user_id = ff.user_id AND st.post_id = p.id
+  ))
+--posts without a date go last instead of on top of every list
+ORDER BY p.published_at DESC NULLS LAST, p.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: NotifyPostsInserted :exec
+--delivered to listeners like the reader when the transaction commits
+SELECT pg_notify('gator_posts', sqlc.arg('feed_id')::uuid::text);
+
+-- name: SearchPosts :many
+--the english configuration the search column and its GIN index are built with
+WITH q AS (
+    SELECT websearch_to_tsquery('english', sqlc.arg('query')) AS query
+)
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, f.name AS feed_name,
+    ts_rank_cd(p.search, q.query)::real AS rank,
+    ts_headline('english', coalesce(p.title, ''), q.query, sqlc.arg('title_options')::text)::text AS title_headline,
+    --tags would end up in the snippet, match on the text between them
+    ts_headline('english', regexp_replace(coalesce(p.content, p.description, ''), '<[^>]*>', ' ', 'g'),
+        q.query, sqlc.arg('snippet_options')::text)::text AS snippet
+FROM posts p
+JOIN feeds f ON f.id = p.feed_id
+CROSS JOIN q
+WHERE p.search @@ q.query
+  AND (sqlc.arg('all')::boolean OR EXISTS (
+      SELECT 1 FROM feed_follows ff WHERE ff.feed_id = p.feed_id AND ff.user_id = sqlc.arg('user_id')
+  ))
+ORDER BY rank DESC, p.published_at DESC NULLS LAST
+LIMIT sqlc.arg('limit');
+
+-- name: SearchPostsInLanguage :many
+--any other configuration, the vectors are built for every post so it is slower
+WITH q AS (
+    SELECT websearch_to_tsquery(sqlc.arg('language')::text::regconfig, sqlc.arg('query')) AS query
+)
+SELECT p.id, p.title, p.url, p.description, p.published_at, p.feed_id, f.name AS feed_name,
+    ts_rank_cd(d.document, q.query)::real AS rank,
+    ts_headline(sqlc.arg('language')::text::regconfig, coalesce(p.title, ''), q.query,
+        sqlc.arg('title_options')::text)::text AS title_headline,
+    ts_headline(sqlc.arg('language')::text::regconfig,
+        regexp_replace(coalesce(p.content, p.description, ''), '<[^>]*>', ' ', 'g'),
+        q.query, sqlc.arg('snippet_options')::text)::text AS snippet
+FROM posts p
+JOIN feeds f ON f.id = p.feed_id
+CROSS JOIN q
+CROSS JOIN LATERAL (
+    SELECT setweight(to_tsvector(sqlc.arg('language')::text::regconfig, coalesce(p.title, '')), 'A') ||
+        setweight(to_tsvector(sqlc.arg('language')::text::regconfig, coalesce(p.description, '')), 'B') ||
+        setweight(to_tsvector(sqlc.arg('language')::text::regconfig, coalesce(p.content, '')), 'C') AS document
+) d
+WHERE d.document @@ q.query
+  AND (sqlc.arg('all')::boolean OR EXISTS (
+      SELECT 1 FROM feed_follows ff WHERE ff.feed_id = p.feed_id AND ff.user_id = sqlc.arg('user_id')
+  ))
+ORDER BY rank DESC, p.published_at DESC NULLS LAST
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN feed_type TEXT NOT NULL DEFAULT 'rss';
+
+UPDATE feeds SET feed_type = 'file' WHERE url LIKE 'file://%';
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN feed_type;
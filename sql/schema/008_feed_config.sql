@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN config JSONB NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN config;
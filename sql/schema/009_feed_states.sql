@@ -0,0 +1,10 @@
+-- +goose Up
+
+CREATE TABLE feed_states(
+    feed_id UUID PRIMARY KEY REFERENCES feeds(id) ON DELETE CASCADE,
+    updated_at TIMESTAMP NOT NULL,
+    state TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE feed_states;
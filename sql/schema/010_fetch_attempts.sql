@@ -0,0 +1,20 @@
+-- +goose Up
+
+CREATE TABLE fetch_attempts(
+    id UUID PRIMARY KEY,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    http_status INTEGER,
+    bytes INTEGER NOT NULL,
+    items_parsed INTEGER NOT NULL,
+    posts_inserted INTEGER NOT NULL,
+    duplicates INTEGER NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX fetch_attempts_feed_started_idx ON fetch_attempts(feed_id, started_at DESC);
+CREATE INDEX fetch_attempts_started_idx ON fetch_attempts(started_at);
+
+-- +goose Down
+DROP TABLE fetch_attempts;
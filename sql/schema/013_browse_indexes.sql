@@ -0,0 +1,12 @@
+-- +goose Up
+
+--browse pages through posts newest first on (published_at, id) with undated posts as the
+--oldest. The queries compare and sort on the same COALESCE expression so these indexes give
+--the order and start at the cursor: the first walks all posts, for users who follow many
+--feeds, the second the posts of one feed, for --feed and users who follow few
+CREATE INDEX posts_published_idx ON posts((COALESCE(published_at, '-infinity'::timestamp)) DESC, id DESC);
+CREATE INDEX posts_feed_published_idx ON posts(feed_id, (COALESCE(published_at, '-infinity'::timestamp)) DESC, id DESC);
+
+-- +goose Down
+DROP INDEX posts_feed_published_idx;
+DROP INDEX posts_published_idx;
@@ -0,0 +1,6 @@
+-- +goose Up
+
+ALTER TABLE posts ADD COLUMN enclosure_url TEXT;
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN enclosure_url;
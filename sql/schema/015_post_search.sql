@@ -0,0 +1,18 @@
+-- +goose Up
+
+ALTER TABLE posts ADD COLUMN content TEXT;
+
+--kept up to date by Postgres, title weighs most and content least in the ranking.
+--search uses it for the english configuration, other languages are matched on the fly
+ALTER TABLE posts ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'C')
+) STORED;
+
+CREATE INDEX posts_search_idx ON posts USING GIN (search);
+
+-- +goose Down
+DROP INDEX posts_search_idx;
+ALTER TABLE posts DROP COLUMN search;
+ALTER TABLE posts DROP COLUMN content;
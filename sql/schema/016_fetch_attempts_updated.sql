@@ -0,0 +1,7 @@
+-- +goose Up
+
+--posts a fetch refreshed, like sitemap pages whose <lastmod> moved forward
+ALTER TABLE fetch_attempts ADD COLUMN posts_updated INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE fetch_attempts DROP COLUMN posts_updated;
@@ -0,0 +1,7 @@
+-- +goose Up
+
+--posts without a date were stored with the zero time instead of NULL
+UPDATE posts SET published_at = NULL WHERE published_at = '0001-01-01 00:00:00';
+
+-- +goose Down
+--nothing to undo, the zero dates are not put back
@@ -0,0 +1,8 @@
+-- +goose Up
+
+--when we last asked the hub for the subscription, NULL once the hub verified or there is
+--no request waiting. Kept in the database so a verification arriving after a restart is accepted
+ALTER TABLE websub_subscriptions ADD COLUMN requested_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE websub_subscriptions DROP COLUMN requested_at;
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/max-durnea/blog-aggregator/internal/sources"
+)
+
+//check a feed against its spec and list the problems by severity:
+//validate <url|feed name>. Fails if there are errors.
+func handlerValidate(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) != 1 {
+		return invalidArgument("provide the url or the name of a feed")
+	}
+	feedURL := cmd.args[0]
+	if !strings.Contains(feedURL, "://") {
+		feed, err := lookupFeed(ctx, s, feedURL)
+		if err != nil {
+			return err
+		}
+		switch feed.FeedType {
+		case sources.TypeRSS, sources.TypeAtom, sources.TypeJSONFeed, sources.TypeFile:
+		default:
+			s.out.message("%v is a %v feed, there is no feed document to validate", feed.Name, feed.FeedType)
+			return nil
+		}
+		feedURL = feed.Url
+	}
+
+	data, meta, err := fetchDocument(ctx, feedURL)
+	if err != nil {
+		return fmt.Errorf("could not fetch feed: %w", err)
+	}
+	issues := sources.Validate(data, meta.Header.Get("Content-Type"))
+	counts := map[string]int{}
+	records := make([]issueRecord, 0, len(issues))
+	for _, issue := range issues {
+		counts[issue.Severity]++
+		records = append(records, newIssueRecord(issue))
+	}
+	err = writeList(s.out, records, func(w io.Writer, issue issueRecord) {
+		where := "feed"
+		if issue.Item > 0 {
+			where = fmt.Sprintf("item %d", issue.Item)
+		}
+		fmt.Fprintf(w, "[%v] %v: %v\n", issue.Severity, where, issue.Message)
+	})
+	if err != nil {
+		return err
+	}
+	s.out.message("%v: %v errors, %v warnings, %v notes", feedURL,
+		counts[sources.SeverityError], counts[sources.SeverityWarning], counts[sources.SeverityInfo])
+	if counts[sources.SeverityError] > 0 {
+		return invalidArgument("%v does not validate", feedURL)
+	}
+	return nil
+}
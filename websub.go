@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/max-durnea/blog-aggregator/internal/database"
+	"github.com/max-durnea/blog-aggregator/internal/sources"
+)
+
+const (
+	//lease we ask the hub for, hubs are free to grant a different one
+	websubLeaseSeconds = 10 * 24 * 60 * 60
+	//renew subscriptions this long before their lease runs out
+	websubRenewBefore = time.Hour
+	//pushed feed documents larger than this are rejected
+	websubMaxBody = 10 << 20
+	//wait this long before asking a hub again, doubling with every failed request
+	websubRetryAfter    = 5 * time.Minute
+	websubMaxRetryAfter = 6 * time.Hour
+)
+
+//WebSub (PubSubHubbub) subscriber: subscribes to hubs and receives pushed content on a callback server
+type webSub struct {
+	callbackURL *url.URL
+	client      *http.Client
+	server      *http.Server
+
+	mu sync.Mutex
+	//the subscription requests we sent by feed, until the hub verifies them, so failed, denied
+	//and unverified requests back off. Whether a request is waiting for verification is kept
+	//in websub_subscriptions.requested_at instead, to survive a restart
+	requests map[uuid.UUID]*websubRequest
+	//a renewal run is going on in the background
+	renewing atomic.Bool
+	renewals sync.WaitGroup
+}
+
+type websubRequest struct {
+	//failed, denied or unverified requests in a row
+	failures int
+	//the last request failed, so the hub had nothing to verify
+	failed bool
+	//the hub is not asked again until then
+	retryAt time.Time
+}
+
+//wait before asking the hub again, longer with every failure in a row
+func (r *websubRequest) backOff() {
+	r.failures++
+	r.retryAt = time.Now().Add(min(websubRetryAfter<<min(r.failures-1, 10), websubMaxRetryAfter))
+}
+
+//the callback server is built here but only started by listen
+func newWebSub(s *state, listenAddr, callback string) (*webSub, error) {
+	callbackURL, err := url.Parse(strings.TrimSuffix(callback, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if callbackURL.Scheme != "http" && callbackURL.Scheme != "https" {
+		return nil, fmt.Errorf("callback must be an http(s) URL: %s", callback)
+	}
+	w := &webSub{
+		callbackURL: callbackURL,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		requests:    map[uuid.UUID]*websubRequest{},
+	}
+	w.server = &http.Server{
+		Addr:              listenAddr,
+		Handler:           w.handler(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return w, nil
+}
+
+//every feed gets its own callback URL so we know which subscription a request belongs to
+func (w *webSub) callbackFor(feedID uuid.UUID) string {
+	return w.callbackURL.String() + "/" + feedID.String()
+}
+
+//start the callback server, blocks until the server fails
+func (w *webSub) listen() error {
+	return w.server.ListenAndServe()
+}
+
+//the routes of the callback server: verification requests and pushed content
+func (w *webSub) handler(s *state) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+w.callbackURL.Path+"/{feedID}", func(rw http.ResponseWriter, r *http.Request) {
+		w.handleVerification(s, rw, r)
+	})
+	mux.HandleFunc("POST "+w.callbackURL.Path+"/{feedID}", func(rw http.ResponseWriter, r *http.Request) {
+		w.handleContent(s, rw, r)
+	})
+	return mux
+}
+
+//stop accepting pushes and wait for the ones being stored and a renewal run
+func (w *webSub) shutdown(ctx context.Context) error {
+	renewed := make(chan struct{})
+	go func() {
+		w.renewals.Wait()
+		close(renewed)
+	}()
+	select {
+	case <-renewed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return w.server.Shutdown(ctx)
+}
+
+//ask the hub to start pushing a topic to us, the hub confirms through handleVerification.
+//The request is remembered so the verification is accepted and renewals can back off.
+//A request the hub accepted but never verified counts as failed when we ask again
+func (w *webSub) subscribe(ctx context.Context, s *state, feedID uuid.UUID, hubURL, topicURL string) error {
+	w.mu.Lock()
+	request := w.requests[feedID]
+	if request == nil {
+		request = &websubRequest{}
+		w.requests[feedID] = request
+	}
+	w.mu.Unlock()
+	unverified, err := w.requestSubscription(ctx, s, feedID, hubURL, topicURL)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	unverified = unverified && !request.failed
+	request.failed = err != nil
+	if unverified {
+		slog.Warn("WebSub hub never verified the last subscription request", "feed_id", feedID, "hub", hubURL)
+	}
+	if err != nil || unverified {
+		request.backOff()
+	} else {
+		//give the hub time to verify before asking again
+		request.failures = 0
+		request.retryAt = time.Now().Add(websubRetryAfter)
+	}
+	return err
+}
+
+//whether the hub may be asked again, it is not if the last request was too recent or failed
+//not long ago
+func (w *webSub) renewalDue(feedID uuid.UUID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	request := w.requests[feedID]
+	return request == nil || !time.Now().Before(request.retryAt)
+}
+
+func (w *webSub) forgetRequest(feedID uuid.UUID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.requests, feedID)
+}
+
+//the hub turned our request down, polling takes over and the hub is asked again after a backoff
+func (w *webSub) requestDenied(feedID uuid.UUID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	request := w.requests[feedID]
+	if request == nil {
+		request = &websubRequest{}
+		w.requests[feedID] = request
+	}
+	request.backOff()
+}
+
+//send a subscription request, reporting whether the previous one is still waiting for verification
+func (w *webSub) requestSubscription(ctx context.Context, s *state, feedID uuid.UUID, hubURL, topicURL string) (bool, error) {
+	//keep the secret of an existing subscription so pushes already in flight still verify
+	secret := ""
+	existing, err := s.db.GetWebSubSubscriptionByFeed(ctx, feedID)
+	if err == nil && existing.HubUrl == hubURL && existing.TopicUrl == topicURL {
+		secret = existing.Secret
+	} else if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	unverified := err == nil && existing.RequestedAt.Valid
+	if secret == "" {
+		secret, err = newWebSubSecret()
+		if err != nil {
+			return unverified, err
+		}
+	}
+	//the subscription and its request have to exist before the request, hubs may verify synchronously
+	_, err = s.db.UpsertWebSubSubscription(ctx, database.UpsertWebSubSubscriptionParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		FeedID:    feedID,
+		HubUrl:    hubURL,
+		TopicUrl:  topicURL,
+		Secret:    secret,
+	})
+	if err != nil {
+		return unverified, err
+	}
+	form := url.Values{}
+	form.Set("hub.mode", "subscribe")
+	form.Set("hub.topic", topicURL)
+	form.Set("hub.callback", w.callbackFor(feedID))
+	form.Set("hub.secret", secret)
+	form.Set("hub.lease_seconds", strconv.Itoa(websubLeaseSeconds))
+	req, err := http.NewRequestWithContext(ctx, "POST", hubURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return unverified, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return unverified, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return unverified, fmt.Errorf("hub responded with %v: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return unverified, nil
+}
+
+//resubscribe before leases run out, lapsed subscriptions are polled again until renewed.
+//Renewals run in the background, one run at a time, so a slow hub does not hold up fetching
+func (w *webSub) renewLeases(ctx context.Context, s *state) {
+	if !w.renewing.CompareAndSwap(false, true) {
+		return
+	}
+	w.renewals.Add(1)
+	go func() {
+		defer w.renewals.Done()
+		defer w.renewing.Store(false)
+		subs, err := s.db.GetWebSubSubscriptionsToRenew(ctx, sql.NullTime{Time: time.Now().Add(websubRenewBefore), Valid: true})
+		if err != nil {
+			slog.Error("Failed to fetch WebSub subscriptions to renew", "err", err)
+			return
+		}
+		for _, sub := range subs {
+			if ctx.Err() != nil {
+				return
+			}
+			if !w.renewalDue(sub.FeedID) {
+				continue
+			}
+			if err := w.subscribe(ctx, s, sub.FeedID, sub.HubUrl, sub.TopicUrl); err != nil {
+				slog.Error("Failed to renew WebSub subscription", "feed_id", sub.FeedID, "topic", sub.TopicUrl, "err", err)
+			}
+		}
+	}()
+}
+
+//the hub confirms a subscription by echoing back hub.challenge, or tells us it was denied.
+//Anyone who knows the callback URL can send these, so only requests of ours are confirmed
+//or denied, and unsubscribing is refused: we never ask for it, leases just lapse
+func (w *webSub) handleVerification(s *state, rw http.ResponseWriter, r *http.Request) {
+	sub, ok := w.subscriptionFor(s, rw, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("hub.topic") != sub.TopicUrl {
+		http.Error(rw, "unknown topic", http.StatusNotFound)
+		return
+	}
+	mode := query.Get("hub.mode")
+	if (mode == "subscribe" || mode == "denied") && !sub.RequestedAt.Valid {
+		http.Error(rw, "no subscription requested", http.StatusNotFound)
+		return
+	}
+	switch mode {
+	case "subscribe":
+		lease, err := strconv.Atoi(query.Get("hub.lease_seconds"))
+		if err != nil || lease <= 0 {
+			lease = websubLeaseSeconds
+		}
+		expires := time.Now().Add(time.Duration(lease) * time.Second)
+		err = s.db.ActivateWebSubSubscription(r.Context(), database.ActivateWebSubSubscriptionParams{
+			FeedID:         sub.FeedID,
+			LeaseExpiresAt: sql.NullTime{Time: expires, Valid: true},
+		})
+		if err != nil {
+			http.Error(rw, "could not activate subscription", http.StatusInternalServerError)
+			return
+		}
+		w.forgetRequest(sub.FeedID)
+		slog.Info("WebSub subscription active", "feed_id", sub.FeedID, "topic", sub.TopicUrl, "expires", expires)
+	case "denied":
+		if err := s.db.DeleteWebSubSubscription(r.Context(), sub.FeedID); err != nil {
+			http.Error(rw, "could not remove subscription", http.StatusInternalServerError)
+			return
+		}
+		w.requestDenied(sub.FeedID)
+		slog.Info("WebSub subscription denied, polling again", "feed_id", sub.FeedID, "topic", sub.TopicUrl, "reason", query.Get("hub.reason"))
+	case "unsubscribe":
+		http.Error(rw, "no unsubscription requested", http.StatusNotFound)
+		return
+	default:
+		http.Error(rw, "unknown hub.mode", http.StatusBadRequest)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	io.WriteString(rw, query.Get("hub.challenge"))
+}
+
+//content distribution: the hub pushes the updated feed document to us
+func (w *webSub) handleContent(s *state, rw http.ResponseWriter, r *http.Request) {
+	sub, ok := w.subscriptionFor(s, rw, r)
+	if !ok {
+		return
+	}
+	logger := slog.With("feed_id", sub.FeedID, "topic", sub.TopicUrl)
+	body, err := io.ReadAll(io.LimitReader(r.Body, websubMaxBody+1))
+	if err != nil {
+		http.Error(rw, "could not read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > websubMaxBody {
+		http.Error(rw, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	//a bad signature still gets a 2xx so the hub does not retry, the content is just ignored
+	if !validWebSubSignature(sub.Secret, r.Header.Get("X-Hub-Signature"), body) {
+		logger.Warn("Ignoring WebSub push with invalid signature")
+		rw.WriteHeader(http.StatusAccepted)
+		return
+	}
+	feed, err := sources.Parse(body)
+	if err != nil {
+		logger.Error("Failed to parse WebSub push", "err", err)
+		rw.WriteHeader(http.StatusAccepted)
+		return
+	}
+	saved, err := savePosts(r.Context(), s, sub.FeedID, feed)
+	if err != nil {
+		//let the hub retry the delivery
+		logger.Error("Failed to store WebSub push", "err", err)
+		http.Error(rw, "could not store content", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Received WebSub push", "items", len(feed.Items), "inserted", saved.inserted, "updated", saved.updated, "duplicates", saved.duplicates)
+	if err := s.db.MarkFeedFetched(r.Context(), sub.FeedID); err != nil {
+		logger.Error("Failed to mark feed as fetched", "err", err)
+	}
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+//look up the subscription named by the callback path, writing a 404 if there is none
+func (w *webSub) subscriptionFor(s *state, rw http.ResponseWriter, r *http.Request) (database.WebsubSubscription, bool) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		http.NotFound(rw, r)
+		return database.WebsubSubscription{}, false
+	}
+	sub, err := s.db.GetWebSubSubscriptionByFeed(r.Context(), feedID)
+	if err != nil {
+		http.NotFound(rw, r)
+		return database.WebsubSubscription{}, false
+	}
+	return sub, true
+}
+
+//check an X-Hub-Signature header of the form "method=hexdigest" against the body
+func validWebSubSignature(secret, header string, body []byte) bool {
+	method, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	var newHash func() hash.Hash
+	switch method {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func newWebSubSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func sign(newHash func() hash.Hash, secret string, body []byte) string {
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidWebSubSignature(t *testing.T) {
+	body := []byte("<rss></rss>")
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   bool
+	}{
+		{"sha1", "secret", "sha1=" + sign(sha1.New, "secret", body), true},
+		{"sha256", "secret", "sha256=" + sign(sha256.New, "secret", body), true},
+		{"wrong secret", "secret", "sha256=" + sign(sha256.New, "other", body), false},
+		{"method does not match digest", "secret", "sha1=" + sign(sha256.New, "secret", body), false},
+		{"unknown method", "secret", "md5=" + sign(sha256.New, "secret", body), false},
+		{"not hex", "secret", "sha256=zz", false},
+		{"no method", "secret", sign(sha256.New, "secret", body), false},
+		{"empty", "secret", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validWebSubSignature(tt.secret, tt.header, body); got != tt.want {
+				t.Errorf("validWebSubSignature(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+//a stand-in hub: it verifies every subscription against the callback before accepting it,
+//like hubs that verify synchronously, and remembers the secret to sign pushes with
+type testHub struct {
+	t        *testing.T
+	mu       sync.Mutex
+	callback string
+	topic    string
+	secret   string
+	verified bool
+}
+
+func (h *testHub) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("hub.mode") != "subscribe" {
+		http.Error(rw, "bad subscription request", http.StatusBadRequest)
+		return
+	}
+	challenge := uuid.NewString()
+	verify := url.Values{}
+	verify.Set("hub.mode", "subscribe")
+	verify.Set("hub.topic", r.Form.Get("hub.topic"))
+	verify.Set("hub.challenge", challenge)
+	verify.Set("hub.lease_seconds", "3600")
+	resp, err := http.Get(r.Form.Get("hub.callback") + "?" + verify.Encode())
+	if err != nil {
+		h.t.Errorf("verification request failed: %v", err)
+		http.Error(rw, "verification failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	echo, _ := io.ReadAll(resp.Body)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.callback = r.Form.Get("hub.callback")
+	h.topic = r.Form.Get("hub.topic")
+	h.secret = r.Form.Get("hub.secret")
+	h.verified = resp.StatusCode == http.StatusOK && string(echo) == challenge
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+//deliver a feed document to the subscriber the way a hub does
+func (h *testHub) push(body []byte, signature string) (int, error) {
+	h.mu.Lock()
+	callback := h.callback
+	h.mu.Unlock()
+	req, err := http.NewRequest("POST", callback, strings.NewReader(string(body)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/rss+xml")
+	req.Header.Set("X-Hub-Signature", signature)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func rssDocument(link string) []byte {
+	return []byte(fmt.Sprintf(`<rss version="2.0"><channel><title>Test</title><link>https://example.com</link>
+<item><title>Pushed</title><link>%v</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+</channel></rss>`, link))
+}
+
+//subscribe, verification, a signed push, a forged push and lease expiry against a real database
+func TestWebSubSubscriptionFlow(t *testing.T) {
+	ctx := context.Background()
+	s, conn := newTestState(t)
+	topic := "https://example.com/feed.xml"
+	feed := createTestFeed(t, s, topic)
+
+	//the callback URL has to be known before the server can be mounted on it
+	var callbackHandler http.Handler
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		callbackHandler.ServeHTTP(rw, r)
+	}))
+	defer callbackServer.Close()
+	w, err := newWebSub(s, "", callbackServer.URL+"/websub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	callbackHandler = w.server.Handler
+	hub := &testHub{t: t}
+	hubServer := httptest.NewServer(hub)
+	defer hubServer.Close()
+
+	if err := w.subscribe(ctx, s, feed.ID, hubServer.URL, topic); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	hub.mu.Lock()
+	verified, hubTopic, secret := hub.verified, hub.topic, hub.secret
+	hub.mu.Unlock()
+	if !verified {
+		t.Fatal("the callback did not echo the hub's challenge")
+	}
+	if hubTopic != topic || secret == "" {
+		t.Fatalf("hub got topic %q and secret %q", hubTopic, secret)
+	}
+	sub, err := s.db.GetWebSubSubscriptionByFeed(ctx, feed.ID)
+	if err != nil || !sub.LeaseExpiresAt.Valid {
+		t.Fatalf("subscription not active after verification: %+v, %v", sub, err)
+	}
+	if _, err := s.db.ClaimNextFeed(ctx, true); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("a subscribed feed must not be polled, ClaimNextFeed returned %v", err)
+	}
+	//without a callback server nothing receives the pushes, so the feed is polled after all
+	if claimed, err := s.db.ClaimNextFeed(ctx, false); err != nil || claimed.ID != feed.ID {
+		t.Fatalf("without a callback server the subscribed feed must be polled, claimed %v, %v", claimed.ID, err)
+	}
+
+	//only the hub we asked may confirm or deny, and we never ask to unsubscribe
+	for _, mode := range []string{"unsubscribe", "denied", "subscribe"} {
+		forged := url.Values{}
+		forged.Set("hub.mode", mode)
+		forged.Set("hub.topic", topic)
+		forged.Set("hub.challenge", "forged")
+		resp, err := http.Get(w.callbackFor(feed.ID) + "?" + forged.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("forged %v verification: status %v, want 404", mode, resp.StatusCode)
+		}
+	}
+	if after, err := s.db.GetWebSubSubscriptionByFeed(ctx, feed.ID); err != nil || !after.LeaseExpiresAt.Time.Equal(sub.LeaseExpiresAt.Time) {
+		t.Fatalf("forged verifications changed the subscription: %+v, %v", after, err)
+	}
+
+	countPosts := func() int {
+		var n int
+		if err := conn.QueryRow("SELECT count(*) FROM posts WHERE feed_id = $1", feed.ID).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	signed := rssDocument("https://example.com/signed")
+	status, err := hub.push(signed, "sha256="+sign(sha256.New, secret, signed))
+	if err != nil || status != http.StatusAccepted {
+		t.Fatalf("signed push: status %v, %v", status, err)
+	}
+	if n := countPosts(); n != 1 {
+		t.Fatalf("signed push stored %v posts, want 1", n)
+	}
+
+	forged := rssDocument("https://example.com/forged")
+	status, err = hub.push(forged, "sha256="+sign(sha256.New, "not the secret", forged))
+	if err != nil || status != http.StatusAccepted {
+		t.Fatalf("forged push: status %v, %v", status, err)
+	}
+	if n := countPosts(); n != 1 {
+		t.Fatalf("forged push was stored, %v posts", n)
+	}
+
+	//once the lease runs out the feed is polled again
+	_, err = conn.Exec("UPDATE websub_subscriptions SET lease_expires_at = NOW() - interval '1 second' WHERE feed_id = $1", feed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := s.db.ClaimNextFeed(ctx, true)
+	if err != nil {
+		t.Fatalf("ClaimNextFeed after the lease expired: %v", err)
+	}
+	if claimed.ID != feed.ID {
+		t.Fatalf("claimed feed %v, want %v", claimed.ID, feed.ID)
+	}
+}
+
+//a hub that turns every request down is asked once, the next poll waits for the backoff
+func TestWebSubFailingHubIsNotAskedEveryPoll(t *testing.T) {
+	s, _ := newTestState(t)
+	var hubRequests atomic.Int32
+	hubServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		hubRequests.Add(1)
+		http.Error(rw, "no", http.StatusInternalServerError)
+	}))
+	defer hubServer.Close()
+	feedServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Link", fmt.Sprintf(`<%v>; rel="hub"`, hubServer.URL))
+		rw.Write(rssDocument("https://example.com/polled"))
+	}))
+	defer feedServer.Close()
+	feed := createTestFeed(t, s, feedServer.URL)
+
+	w, err := newWebSub(s, "", "https://example.com/websub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.websub = w
+	for poll := range 2 {
+		attempt := scrapeFeeds(context.Background(), s, 10*time.Second)
+		if attempt == nil || attempt.feedID != feed.ID || attempt.err != nil {
+			t.Fatalf("poll %v: %+v", poll, attempt)
+		}
+	}
+	if n := hubRequests.Load(); n != 1 {
+		t.Fatalf("the failing hub was asked %v times over two polls, want 1", n)
+	}
+}
+
+//a hub that accepts requests but never verifies them is backed off like a failing one, and
+//a verification arriving after a restart is still accepted
+func TestWebSubUnverifiedRequests(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestState(t)
+	topic := "https://example.com/feed.xml"
+	feed := createTestFeed(t, s, topic)
+	hubServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer hubServer.Close()
+
+	w, err := newWebSub(s, "", "https://example.com/websub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := w.subscribe(ctx, s, feed.ID, hubServer.URL, topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if failures := w.requests[feed.ID].failures; failures != 1 {
+		t.Fatalf("an unverified request counted as %v failures, want 1", failures)
+	}
+	if w.renewalDue(feed.ID) {
+		t.Fatal("a hub that never verified was due to be asked again right away")
+	}
+
+	//a new subscriber knows nothing of the request, the hub verifies it anyway
+	restarted, err := newWebSub(s, "", "https://example.com/websub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := url.Values{}
+	verify.Set("hub.mode", "subscribe")
+	verify.Set("hub.topic", topic)
+	verify.Set("hub.challenge", "late")
+	rec := httptest.NewRecorder()
+	restarted.server.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/websub/"+feed.ID.String()+"?"+verify.Encode(), nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "late" {
+		t.Fatalf("verification after a restart: status %v, body %q", rec.Code, rec.Body.String())
+	}
+	sub, err := s.db.GetWebSubSubscriptionByFeed(ctx, feed.ID)
+	if err != nil || !sub.LeaseExpiresAt.Valid || sub.RequestedAt.Valid {
+		t.Fatalf("subscription after the late verification: %+v, %v", sub, err)
+	}
+}